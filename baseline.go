@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+)
+
+// baselineEntry is a finding that has been triaged and accepted so it is not reported again
+type baselineEntry struct {
+	Fingerprint string `json:"fingerprint"`
+	Repository  string `json:"repository"`
+	Rule        string `json:"rule"`
+	Path        string `json:"path"`
+	AcceptedBy  string `json:"acceptedBy"`
+	Reason      string `json:"reason"`
+	AcceptedAt  string `json:"acceptedAt"`
+}
+
+type baseline struct {
+	Entries []baselineEntry `json:"entries"`
+}
+
+// fingerprint identifies a secret independently of the commit and the tool that found it,
+// so the same secret showing up again in a later commit or a later run is still recognized
+func (f finding) fingerprint() string {
+	h := sha256.New()
+	for _, part := range []string{f.Host, f.OrgOrUser, f.Kind, f.Repo, f.Rule, f.Path, f.Secret} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func loadBaseline(file string) (*baseline, error) {
+	b := &baseline{}
+
+	content, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return b, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(content, b)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *baseline) fingerprints() map[string]bool {
+	known := make(map[string]bool)
+	for _, entry := range b.Entries {
+		known[entry.Fingerprint] = true
+	}
+	return known
+}
+
+// add records the findings that are not in the baseline yet. Entries that already exist keep
+// who accepted them and why.
+func (b *baseline) add(findings []finding, acceptedBy string, reason string) int {
+	known := b.fingerprints()
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	added := 0
+	for _, f := range findings {
+		fp := f.fingerprint()
+		if known[fp] {
+			continue
+		}
+		known[fp] = true
+		b.Entries = append(b.Entries, baselineEntry{
+			Fingerprint: fp,
+			Repository:  f.id().String(),
+			Rule:        f.Rule,
+			Path:        f.Path,
+			AcceptedBy:  acceptedBy,
+			Reason:      reason,
+			AcceptedAt:  now,
+		})
+		added++
+	}
+
+	sort.SliceStable(b.Entries, func(i, j int) bool {
+		if b.Entries[i].Repository != b.Entries[j].Repository {
+			return b.Entries[i].Repository < b.Entries[j].Repository
+		}
+		return b.Entries[i].Path < b.Entries[j].Path
+	})
+	return added
+}
+
+func (b *baseline) write(file string) error {
+	content, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, append(content, '\n'), 0644)
+}
+
+// filter drops the findings that are part of the baseline and returns how many were dropped
+func (b *baseline) filter(findings []finding) ([]finding, int) {
+	known := b.fingerprints()
+
+	var kept []finding
+	for _, f := range findings {
+		if !known[f.fingerprint()] {
+			kept = append(kept, f)
+		}
+	}
+	return kept, len(findings) - len(kept)
+}
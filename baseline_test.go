@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The fingerprint ignores the commit and the tool, but tells apart the same secret in another
+// host, owner, kind, repo, rule or path
+func TestFingerprint(t *testing.T) {
+	f := finding{Host: "github.com", OrgOrUser: "acme", Kind: repoKind, Repo: "api", Rule: "AWS API Key", Path: "config.yml", Secret: "AKIA"}
+	same := f
+	same.Tool, same.Hash, same.Commit, same.Diff = "repo-supervisor", "abc", "other commit", "+AKIA"
+	if f.fingerprint() != same.fingerprint() {
+		t.Error("the fingerprint depends on the commit or the tool")
+	}
+
+	variants := []func(*finding){
+		func(f *finding) { f.Host = "github.example.com" },
+		func(f *finding) { f.OrgOrUser = "other" },
+		func(f *finding) { f.Kind = gistKind },
+		func(f *finding) { f.Repo = "web" },
+		func(f *finding) { f.Rule = "Generic Secret" },
+		func(f *finding) { f.Path = "config.yaml" },
+		func(f *finding) { f.Secret = "AKIB" },
+		// the parts are separated, so they can't be shifted into each other
+		func(f *finding) { f.OrgOrUser, f.Repo = "acmeapi", "" },
+	}
+	seen := map[string]bool{f.fingerprint(): true}
+	for i, change := range variants {
+		variant := f
+		change(&variant)
+		if seen[variant.fingerprint()] {
+			t.Errorf("variant %d has the fingerprint of another finding", i)
+		}
+		seen[variant.fingerprint()] = true
+	}
+}
+
+// The baseline command accepts the current findings, which a later scan with the baseline drops
+func TestBaselineRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "git-all-secrets-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "baseline.json")
+
+	accepted := finding{Host: "github.com", OrgOrUser: "acme", Kind: repoKind, Repo: "api", Rule: "AWS API Key", Path: "test/keys.go", Secret: "AKIATEST"}
+	b, err := loadBaseline(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added := b.add([]finding{accepted, accepted}, "jdoe", "test fixture"); added != 1 {
+		t.Errorf("added %d entries, want 1", added)
+	}
+	if err := b.write(file); err != nil {
+		t.Fatal(err)
+	}
+
+	// Accepting again keeps who accepted it first
+	b, err = loadBaseline(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added := b.add([]finding{accepted}, "other", "again"); added != 0 || b.Entries[0].AcceptedBy != "jdoe" {
+		t.Errorf("accepting again added %d entries, accepted by %s", added, b.Entries[0].AcceptedBy)
+	}
+	if b.Entries[0].Repository != "github.com/acme/api" {
+		t.Errorf("the entry is for %s", b.Entries[0].Repository)
+	}
+
+	leaked := accepted
+	leaked.Path = "config/prod.yml"
+	kept, dropped := b.filter([]finding{accepted, leaked})
+	if dropped != 1 || len(kept) != 1 || kept[0].Path != "config/prod.yml" {
+		t.Errorf("filter kept %+v and dropped %d", kept, dropped)
+	}
+
+	ioutil.WriteFile(file, []byte("{not json"), 0644)
+	if _, err := loadBaseline(file); err == nil {
+		t.Error("an invalid baseline was read")
+	}
+}
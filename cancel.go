@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// runCtx is cancelled on the first SIGINT or SIGTERM. The API calls and the child processes
+// stop, the repos that were not cloned or scanned yet are recorded in the failure ledger and
+// a partial report is written.
+var runCtx, cancelRun = context.WithCancel(context.Background())
+
+// children are the process groups of the running child processes, killed on a forced exit
+var children = struct {
+	sync.Mutex
+	pids map[int]bool
+}{pids: make(map[int]bool)}
+
+func handleSignals() {
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		sig := <-sigs
+		Info("Received %s, stopping. A partial report will be written, send it again to exit immediately", sig)
+		cancelRun()
+
+		sig = <-sigs
+		Info("Received %s again, exiting without writing the report", sig)
+		children.Lock()
+		for pid := range children.pids {
+			syscall.Kill(-pid, syscall.SIGKILL)
+		}
+		children.Unlock()
+		// The deferred cleanups of run are skipped by os.Exit
+		stopSSHAgent()
+		if askpassScript != "" {
+			os.Remove(askpassScript)
+		}
+		os.Exit(exitFatal)
+	}()
+}
+
+func interrupted() bool {
+	return runCtx.Err() != nil
+}
+
+// runCommand runs the command in its own process group, so that when the context is done the
+// processes it started, such as the git processes of truffleHog, are killed along with it
+func runCommand(ctx context.Context, cmd *exec.Cmd) error {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	pid := cmd.Process.Pid
+	children.Lock()
+	children.pids[pid] = true
+	children.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			syscall.Kill(-pid, syscall.SIGKILL)
+		case <-done:
+		}
+	}()
+
+	err := cmd.Wait()
+	close(done)
+
+	children.Lock()
+	delete(children.pids, pid)
+	children.Unlock()
+
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
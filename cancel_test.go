@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// processGone tells whether the process exited, counting the zombies nobody reaped as gone
+func processGone(pid int) bool {
+	stat, err := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return true
+	}
+	fields := strings.Fields(string(stat[strings.LastIndex(string(stat), ")")+1:]))
+	return len(fields) > 0 && fields[0] == "Z"
+}
+
+// Canceling the run kills the process along with the processes it started
+func TestRunCommandKillsProcessGroup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "git-all-secrets-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pidFile := filepath.Join(dir, "pid")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error)
+	go func() {
+		// like truffleHog starting git
+		cmd := exec.Command("sh", "-c", "sleep 60 & echo $! > "+pidFile+"; wait")
+		result <- runCommand(ctx, cmd)
+	}()
+
+	var child int
+	for deadline := time.Now().Add(5 * time.Second); child == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the command did not start")
+		}
+		content, _ := ioutil.ReadFile(pidFile)
+		child, _ = strconv.Atoi(strings.TrimSpace(string(content)))
+	}
+	cancel()
+
+	select {
+	case err := <-result:
+		if err != context.Canceled {
+			t.Errorf("runCommand = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the command was not killed")
+	}
+	for deadline := time.Now().Add(5 * time.Second); !processGone(child); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the process started by the command is still running")
+		}
+	}
+	children.Lock()
+	running := len(children.pids)
+	children.Unlock()
+	if running != 0 {
+		t.Errorf("%d process groups are still tracked", running)
+	}
+}
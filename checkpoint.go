@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// checkpointEvent is a line of the checkpoint file. The first line holds the fingerprint and the
+// working directory of the scan and every other line records either a listing of the Github API
+// or a finished job.
+type checkpointEvent struct {
+	Fingerprint string          `json:"fingerprint,omitempty"`
+	WorkDir     string          `json:"workDir,omitempty"`
+	Listing     string          `json:"listing,omitempty"`
+	Items       json.RawMessage `json:"items,omitempty"`
+	Stage       string          `json:"stage,omitempty"`
+	Dir         string          `json:"dir,omitempty"`
+}
+
+// checkpoint records the progress of a scan so that the resume flag can continue it after it
+// died or was interrupted. Events are appended as they happen, so a crash loses at most the
+// line being written, which is ignored when the checkpoint is read back.
+type checkpoint struct {
+	mutex    sync.Mutex
+	file     *os.File
+	path     string
+	size     int64
+	listings map[string]json.RawMessage
+	done     map[string]bool
+}
+
+// scanCheckpoint is nil when there is no checkpoint, such as with the retry-failed command
+var scanCheckpoint *checkpoint
+
+func checkpointFile() string {
+	return *outputFile + ".checkpoint.jsonl"
+}
+
+// checkpointFingerprint changes when the rules, the tools, what is scanned or how the findings
+// are filtered change, in which case the results of the previous run can't be reused. The
+// findings saved before a clone is deleted are already filtered, so they can't be filtered again.
+func checkpointFingerprint() string {
+	rules, _ := ioutil.ReadFile(thogRulesFile)
+	var settings []byte
+	if *orgConfig != "" {
+		settings, _ = ioutil.ReadFile(*orgConfig)
+	}
+
+	parts := []string{
+		string(rules), string(settings),
+		*toolName, strconv.FormatBool(*thogEntropy),
+		*org, *user, *repoURL, *gistURL, *teamName,
+		strconv.FormatBool(*orgOnly), strconv.FormatBool(*scanPrivateReposOnly), strconv.FormatBool(*cloneForks),
+		*cloneStrategy, strconv.Itoa(*cloneDepth), *shallowSince,
+		*includeRepos, *excludeRepos, *blacklist,
+		*archived, strconv.FormatBool(*skipDisabled), *visibility, *languages, *topics,
+		strconv.Itoa(*minSize), strconv.Itoa(*maxSize), *pushedAfter,
+		*includePaths, *excludePaths, *linguistFiles, *baselineFile,
+	}
+	hash := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(hash[:])
+}
+
+func checkpointKey(stage string, dir string) string {
+	return stage + " " + strings.TrimSuffix(dir, "/")
+}
+
+// checkpointWorkDir is the working directory of the scan that wrote the checkpoint, where its
+// clones and results are
+func checkpointWorkDir(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	var event checkpointEvent
+	json.NewDecoder(file).Decode(&event)
+	return event.WorkDir
+}
+
+// readCheckpoint replays the events of a checkpoint file written with the given fingerprint.
+// Lines that can't be read are skipped, and the size of the file up to its last complete line
+// is kept so that the line a dead scan was writing can be cut off before appending to it.
+func readCheckpoint(path string, fingerprint string) (*checkpoint, bool, error) {
+	c := &checkpoint{path: path, listings: make(map[string]json.RawMessage), done: make(map[string]bool)}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	first := true
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// the last line of a scan that died while writing it, if any
+			break
+		} else if err != nil {
+			return nil, false, err
+		}
+		c.size += int64(len(line))
+
+		var event checkpointEvent
+		if json.Unmarshal(line, &event) != nil {
+			if first {
+				return nil, false, nil
+			}
+			continue
+		}
+		if first {
+			if event.Fingerprint != fingerprint {
+				return nil, false, nil
+			}
+			first = false
+			continue
+		}
+		if event.Listing != "" {
+			c.listings[event.Listing] = event.Items
+		} else {
+			c.done[checkpointKey(event.Stage, event.Dir)] = true
+		}
+	}
+	return c, !first, nil
+}
+
+// openCheckpoint starts a new checkpoint, or continues the one of the previous run when resuming.
+// A new scan starts without the clones and results a previous run left in the working directory.
+func openCheckpoint(path string, resume bool, workDir string) (*checkpoint, error) {
+	fingerprint := checkpointFingerprint()
+
+	if resume {
+		c, valid, err := readCheckpoint(path, fingerprint)
+		switch {
+		case os.IsNotExist(err):
+			Info("There is no checkpoint at %s to resume from, starting a new scan", path)
+		case err != nil:
+			return nil, err
+		case !valid:
+			Info("The rules, the tools or what is scanned changed since the checkpoint at %s was written, starting a new scan", path)
+		default:
+			Info("Resuming from %s: %d listings and %d finished clones and scans are reused", path, len(c.listings), len(c.done))
+			c.file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+			if err != nil {
+				return nil, err
+			}
+			// The new events must not be glued to a partial last line
+			if err := c.file.Truncate(c.size); err != nil {
+				c.file.Close()
+				return nil, err
+			}
+			return c, nil
+		}
+	}
+
+	if err := clearPreviousRun(workDir); err != nil {
+		return nil, err
+	}
+
+	c := &checkpoint{path: path, listings: make(map[string]json.RawMessage), done: make(map[string]bool)}
+	var err error
+	c.file, err = os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return c, c.append(checkpointEvent{Fingerprint: fingerprint, WorkDir: workDir})
+}
+
+func (c *checkpoint) append(event checkpointEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = c.file.Write(append(line, '\n'))
+	return err
+}
+
+func (c *checkpoint) record(event checkpointEvent) {
+	if err := c.append(event); err != nil {
+		fmt.Fprintln(console, "Could not write the checkpoint:", err)
+	}
+}
+
+// listing reads a listing of the Github API saved by the previous run into v
+func (c *checkpoint) listing(key string, v interface{}) bool {
+	if c == nil {
+		return false
+	}
+	c.mutex.Lock()
+	items, ok := c.listings[key]
+	c.mutex.Unlock()
+	return ok && json.Unmarshal(items, v) == nil
+}
+
+// saveListing saves a complete listing of the Github API
+func (c *checkpoint) saveListing(key string, v interface{}) {
+	if c == nil {
+		return
+	}
+	items, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.listings[key] = items
+	c.record(checkpointEvent{Listing: key, Items: items})
+}
+
+// finished tells whether the clone, or the scan of a tool, of the repo in dir finished in a previous run
+func (c *checkpoint) finished(stage string, dir string) bool {
+	if c == nil {
+		return false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.done[checkpointKey(stage, dir)]
+}
+
+func (c *checkpoint) finish(stage string, dir string) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.done[checkpointKey(stage, dir)] = true
+	c.record(checkpointEvent{Stage: stage, Dir: strings.TrimSuffix(dir, "/")})
+}
+
+func (c *checkpoint) close() {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.file.Close()
+}
+
+// remove deletes the checkpoint once the scan is complete, so that a later resume does not
+// reuse listings that might be out of date
+func (c *checkpoint) remove() {
+	if c == nil {
+		return
+	}
+	c.close()
+	os.Remove(c.path)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// A scan that dies while writing an event leaves a torn last line, which a resumed scan cuts off
+// before appending its own events
+func TestCheckpointResumeAfterTornLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "git-all-secrets-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "output.txt.checkpoint.jsonl")
+
+	header, _ := json.Marshal(checkpointEvent{Fingerprint: checkpointFingerprint(), WorkDir: dir})
+	content := string(header) + "\n" +
+		`{"listing":"orgs/acme/repos","items":[{"name":"api"}]}` + "\n" +
+		`not a checkpoint event` + "\n" +
+		`{"stage":"clone","dir":"` + dir + `/repos/github.com/acme/repo/api"}` + "\n" +
+		`{"stage":"truffleHog","dir":"` + dir + `/repos/github.c`
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := openCheckpoint(path, true, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.finish("truffleHog", dir+"/repos/github.com/acme/repo/api/")
+	c.saveListing("orgs/acme/members", []string{"jdoe"})
+	c.close()
+
+	// The events of both runs are read back on the next resume
+	c, valid, err := readCheckpoint(path, checkpointFingerprint())
+	if err != nil || !valid {
+		t.Fatalf("readCheckpoint = %v, %v", valid, err)
+	}
+	var repos []map[string]string
+	if !c.listing("orgs/acme/repos", &repos) || len(repos) != 1 {
+		t.Error("the listing of the first run was lost")
+	}
+	var members []string
+	if !c.listing("orgs/acme/members", &members) || len(members) != 1 {
+		t.Error("the listing of the resumed run was lost")
+	}
+	for _, stage := range []string{"clone", "truffleHog"} {
+		if !c.finished(stage, dir+"/repos/github.com/acme/repo/api") {
+			t.Errorf("the %s of the repo is not finished", stage)
+		}
+	}
+}
+
+// A checkpoint of another scan is not resumed
+func TestCheckpointFingerprintMismatch(t *testing.T) {
+	file, err := ioutil.TempFile("", "git-all-secrets-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString(`{"fingerprint":"other"}` + "\n" + `{"stage":"clone","dir":"/w/repos/a"}` + "\n")
+	file.Close()
+
+	if _, valid, err := readCheckpoint(file.Name(), checkpointFingerprint()); err != nil || valid {
+		t.Errorf("readCheckpoint = %v, %v, want an invalid checkpoint", valid, err)
+	}
+}
+
+// The findings saved with keepClones=false are already filtered, so changing the filters starts a new scan
+func TestCheckpointFingerprintFilters(t *testing.T) {
+	flags := map[string]*string{
+		"includeRepos": includeRepos, "excludeRepos": excludeRepos, "blacklist": blacklist, "visibility": visibility,
+		"pushedAfter": pushedAfter, "includePaths": includePaths, "excludePaths": excludePaths,
+		"linguistFiles": linguistFiles, "baseline": baselineFile,
+	}
+	for name, f := range flags {
+		previous := checkpointFingerprint()
+		value := *f
+		*f = "changed"
+		changed := checkpointFingerprint()
+		*f = value
+		if changed == previous {
+			t.Errorf("the checkpoint fingerprint does not depend on the %s flag", name)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// cloneStrategyArgs returns the git clone arguments of the cloneStrategy flag. The shallow
+// strategies keep every branch since the scanners look at all of them.
+func cloneStrategyArgs() []string {
+	switch *cloneStrategy {
+	case "depth":
+		return []string{"--depth", strconv.Itoa(*cloneDepth), "--no-single-branch"}
+	case "since":
+		return []string{"--shallow-since", *shallowSince, "--no-single-branch"}
+	case "blobless":
+		// blobs are fetched lazily when the scanners read them
+		return []string{"--filter=blob:none"}
+	}
+	return nil
+}
+
+// fetchStrategyArgs returns the git fetch arguments that keep a mirror as shallow as it was cloned
+func fetchStrategyArgs() []string {
+	switch *cloneStrategy {
+	case "depth":
+		return []string{"--depth", strconv.Itoa(*cloneDepth)}
+	case "since":
+		return []string{"--shallow-since", *shallowSince}
+	}
+	return nil
+}
+
+func checkCloneStrategy(strategy string, depth int, since string) string {
+	switch strategy {
+	case "full", "blobless":
+	case "depth":
+		if depth < 1 {
+			return "cloneDepth should be at least 1 with the depth cloneStrategy"
+		}
+	case "since":
+		if since == "" {
+			return "shallowSince should be provided with the since cloneStrategy"
+		}
+	default:
+		return "Please enter either full, depth, since or blobless as the cloneStrategy. Default is full."
+	}
+	return ""
+}
+
+// truncatedHistory describes how the history of the clone was truncated, or returns an empty
+// string if the whole history is there
+func truncatedHistory(home string) string {
+	out, err := exec.Command(*gitPath, "-C", home, "rev-parse", "--is-shallow-repository").Output()
+	if err != nil || strings.TrimSpace(string(out)) != "true" {
+		return ""
+	}
+
+	switch *cloneStrategy {
+	case "depth":
+		return "only the last " + strconv.Itoa(*cloneDepth) + " commits of each branch were scanned"
+	case "since":
+		return "only the commits since " + *shallowSince + " were scanned"
+	}
+	return "the history of this clone is shallow"
+}
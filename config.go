@@ -0,0 +1,280 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const repoConfigName = ".git-all-secrets.yml"
+
+// scanConfig is read from the .git-all-secrets.yml file at the root of a repo. The org
+// configuration uses the same keys, applies them to every repo and can lock rules so that
+// repos are not allowed to disable or override them.
+type scanConfig struct {
+	Rules          map[string]rule `yaml:"rules"`
+	DisableRules   []string        `yaml:"disableRules"`
+	ExcludePaths   []string        `yaml:"excludePaths"`
+	Entropy        *bool           `yaml:"entropy"`
+	LockedRules    []string        `yaml:"lockedRules"`
+	LockedSeverity string          `yaml:"lockedSeverity"`
+
+	// repoExcludePaths are the excludePaths of the repo, which don't apply to the locked rules
+	repoExcludePaths []string
+}
+
+// rule is either the pattern alone, as truffleHog expects it, or the pattern along with the
+// severity of its findings. Without a pattern, only the severity of the rule is changed.
+type rule struct {
+	Pattern  string `json:"pattern" yaml:"pattern"`
+	Severity string `json:"severity" yaml:"severity"`
+}
+
+func (r *rule) UnmarshalJSON(data []byte) error {
+	if json.Unmarshal(data, &r.Pattern) == nil {
+		return nil
+	}
+	type plain rule
+	if err := json.Unmarshal(data, (*plain)(r)); err != nil {
+		return err
+	}
+	return r.validate()
+}
+
+func (r *rule) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if unmarshal(&r.Pattern) == nil {
+		return nil
+	}
+	type plain rule
+	if err := unmarshal((*plain)(r)); err != nil {
+		return err
+	}
+	return r.validate()
+}
+
+func (r *rule) validate() error {
+	if r.Severity != "" && severityRank(r.Severity) < 0 {
+		return fmt.Errorf("invalid severity %q, use low, medium, high or critical", r.Severity)
+	}
+	return nil
+}
+
+// orgSettings is the configuration provided with the orgConfig flag
+var orgSettings = &scanConfig{}
+
+// fileRules are the rules of the rules file, read by checkTools
+var fileRules = map[string]rule{}
+
+// readRules reads a rules file of truffleHog, whose rules may also carry a severity
+func readRules(file string) (map[string]rule, error) {
+	rules := make(map[string]rule)
+	content, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return rules, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &rules); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return rules, nil
+}
+
+func readScanConfig(file string) (*scanConfig, error) {
+	config := &scanConfig{}
+
+	content, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return config, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = yaml.UnmarshalStrict(content, config)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return config, nil
+}
+
+func severityRank(severity string) int {
+	for i, s := range severities {
+		if s == severity {
+			return i
+		}
+	}
+	return -1
+}
+
+func (config *scanConfig) locked(rule string) bool {
+	for _, r := range config.LockedRules {
+		if r == rule {
+			return true
+		}
+	}
+	return config.LockedSeverity != "" && severityRank(config.severity(rule)) >= severityRank(config.LockedSeverity)
+}
+
+// severity of the findings of the rule, as configured or else as set in the rules file
+func (config *scanConfig) severity(name string) string {
+	if r, ok := config.Rules[name]; ok && r.Severity != "" {
+		return r.Severity
+	}
+	return ruleSeverity(name)
+}
+
+// loadRepoConfig reads the .git-all-secrets.yml of the repo cloned in home and merges it
+// with the org configuration. Disabling or overriding a locked rule is ignored with a warning.
+// Only the org configuration applies when the repo has no working copy.
+func loadRepoConfig(home string) (*scanConfig, error) {
+	if home == "" {
+		return orgSettings, nil
+	}
+	repo, err := readScanConfig(filepath.Join(home, repoConfigName))
+	if err != nil {
+		return orgSettings, err
+	}
+
+	config := &scanConfig{
+		Rules:            make(map[string]rule),
+		DisableRules:     append([]string{}, orgSettings.DisableRules...),
+		ExcludePaths:     orgSettings.ExcludePaths,
+		Entropy:          orgSettings.Entropy,
+		repoExcludePaths: repo.ExcludePaths,
+	}
+	for name, r := range orgSettings.Rules {
+		config.Rules[name] = r
+	}
+	for name, r := range repo.Rules {
+		// The rules added by the repo only apply to it, but the ones it shares with the rules
+		// file or the org configuration can't be weakened when they are locked
+		_, inFile := fileRules[name]
+		_, inOrg := orgSettings.Rules[name]
+		if (inFile || inOrg) && orgSettings.locked(name) {
+			Info("%s in %s can't override the locked rule %s, ignoring it", repoConfigName, home, name)
+			continue
+		}
+		merged := config.Rules[name]
+		if r.Pattern != "" {
+			merged.Pattern = r.Pattern
+		}
+		if r.Severity != "" {
+			merged.Severity = r.Severity
+		}
+		config.Rules[name] = merged
+	}
+	for _, rule := range repo.DisableRules {
+		if orgSettings.locked(rule) {
+			Info("%s in %s can't disable the locked rule %s, ignoring it", repoConfigName, home, rule)
+			continue
+		}
+		config.DisableRules = append(config.DisableRules, rule)
+	}
+	if repo.Entropy != nil {
+		config.Entropy = repo.Entropy
+	}
+	return config, nil
+}
+
+func (config *scanConfig) disabled(rule string) bool {
+	for _, r := range config.DisableRules {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// excluded tells whether the findings of the rule in this path are dropped. The excludePaths of
+// the repo can't hide the findings of the locked rules.
+func (config *scanConfig) excluded(rule string, path string) bool {
+	patterns := config.ExcludePaths
+	if !orgSettings.locked(rule) {
+		patterns = append(append([]string{}, patterns...), config.repoExcludePaths...)
+	}
+	for _, pattern := range patterns {
+		if matchPath(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func (config *scanConfig) entropy() bool {
+	if config.Entropy != nil {
+		return *config.Entropy
+	}
+	return *thogEntropy
+}
+
+// thogRules returns the rules file truffleHog should use for this configuration. When rules
+// are added or disabled, the merged rules are written to the results directory of the repo.
+func (config *scanConfig) thogRules(outputDir string) (string, error) {
+	if len(config.Rules) == 0 && len(config.DisableRules) == 0 && !severitiesIn(fileRules) {
+		return thogRulesFile, nil
+	}
+
+	// truffleHog only knows about the patterns
+	patterns := make(map[string]string)
+	for name, r := range fileRules {
+		patterns[name] = r.Pattern
+	}
+	for name, r := range config.Rules {
+		if r.Pattern != "" {
+			patterns[name] = r.Pattern
+		}
+	}
+	for _, name := range config.DisableRules {
+		delete(patterns, name)
+	}
+
+	content, err := json.MarshalIndent(patterns, "", "    ")
+	if err != nil {
+		return "", err
+	}
+	rulesFile := outputDir + "/truffleHog-rules.json"
+	return rulesFile, ioutil.WriteFile(rulesFile, content, 0644)
+}
+
+func severitiesIn(rules map[string]rule) bool {
+	for _, r := range rules {
+		if r.Severity != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// applyRepoConfigs drops the findings of disabled rules and excluded paths, for the tools that
+// don't know about the repo configuration, and counts them as suppressed. The findings that are
+// kept get the severity their rule is configured with.
+func applyRepoConfigs(findings []finding, suppressed map[string]int) []finding {
+	configs := make(map[string]*scanConfig)
+
+	var kept []finding
+	for _, f := range findings {
+		home := repoPath(f.id())
+
+		config, ok := configs[home]
+		if !ok {
+			var err error
+			config, err = loadRepoConfig(home)
+			if err != nil {
+				Info("Ignoring the invalid %s of %s: %v", repoConfigName, f.id(), err)
+			}
+			configs[home] = config
+		}
+
+		if config.disabled(f.Rule) || config.excluded(f.Rule, f.Path) {
+			suppressed[repoConfigName]++
+		} else {
+			f.Severity = config.severity(f.Rule)
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// The repo configuration can't weaken the rules the org configuration locks
+func TestLoadRepoConfigLockedRules(t *testing.T) {
+	home, err := ioutil.TempDir("", "git-all-secrets-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	repoConfig := `
+rules:
+  AWS API Key: x^
+  Internal Token: itk_[0-9a-f]{32}
+disableRules: [RSA private key, Slack Token]
+excludePaths: ["**"]
+`
+	if err := ioutil.WriteFile(filepath.Join(home, repoConfigName), []byte(repoConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(previous *scanConfig, rules map[string]rule) { orgSettings, fileRules = previous, rules }(orgSettings, fileRules)
+	orgSettings = &scanConfig{LockedSeverity: "critical", ExcludePaths: []string{"vendor/**"}}
+	fileRules, err = readRules("rules.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := loadRepoConfig(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, overridden := config.Rules["AWS API Key"]; overridden {
+		t.Error("the locked AWS API Key rule was overridden")
+	}
+	if config.Rules["Internal Token"].Pattern == "" {
+		t.Error("the rule added by the repo is missing")
+	}
+	if config.disabled("RSA private key") {
+		t.Error("the locked RSA private key rule was disabled")
+	}
+	if !config.disabled("Slack Token") {
+		t.Error("the Slack Token rule was not disabled")
+	}
+
+	tests := []struct {
+		rule     string
+		path     string
+		excluded bool
+	}{
+		{"AWS API Key", "config/prod.yml", false},
+		{"AWS API Key", "vendor/lib/keys.go", true},
+		{"Slack Token", "config/prod.yml", true},
+	}
+	for _, test := range tests {
+		if excluded := config.excluded(test.rule, test.path); excluded != test.excluded {
+			t.Errorf("excluded(%q, %q) = %v, want %v", test.rule, test.path, excluded, test.excluded)
+		}
+	}
+}
+
+// Rules can carry the severity of their findings in the rules file and the configurations
+func TestRuleSeverities(t *testing.T) {
+	dir, err := ioutil.TempDir("", "git-all-secrets-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	rulesJSON := `{
+    "AWS API Key": "AKIA[0-9A-Z]{16}",
+    "Slack Token": {"pattern": "xox[p|b|o|a].*", "severity": "critical"},
+    "Staging Key": {"pattern": "stg_[0-9a-f]{32}", "severity": "low"}
+}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "rules.json"), []byte(rulesJSON), 0644); err != nil {
+		t.Fatal(err)
+	}
+	repoConfig := `
+rules:
+  Internal Token:
+    pattern: itk_[0-9a-f]{32}
+    severity: high
+  Staging Key:
+    severity: medium
+  Slack Token:
+    severity: low
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, repoConfigName), []byte(repoConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(previous *scanConfig, rules map[string]rule, file string) {
+		orgSettings, fileRules, thogRulesFile = previous, rules, file
+	}(orgSettings, fileRules, thogRulesFile)
+	thogRulesFile = filepath.Join(dir, "rules.json")
+	fileRules, err = readRules(thogRulesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orgSettings, err = readScanConfig(filepath.Join(dir, "missing.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	orgSettings.LockedSeverity = "critical"
+
+	config, err := loadRepoConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		rule     string
+		severity string
+	}{
+		{"AWS API Key", "critical"},
+		{"Slack Token", "critical"},
+		{"Staging Key", "medium"},
+		{"Internal Token", "high"},
+		{"Custom Rule", "medium"},
+		{entropyRule, "low"},
+	}
+	for _, test := range tests {
+		if severity := config.severity(test.rule); severity != test.severity {
+			t.Errorf("severity(%q) = %s, want %s", test.rule, severity, test.severity)
+		}
+	}
+
+	// truffleHog gets the patterns alone
+	file, err := config.thogRules(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var patterns map[string]string
+	if err := json.Unmarshal(content, &patterns); err != nil {
+		t.Fatalf("truffleHog can't read the rules: %v", err)
+	}
+	want := map[string]string{
+		"AWS API Key":    "AKIA[0-9A-Z]{16}",
+		"Slack Token":    "xox[p|b|o|a].*",
+		"Staging Key":    "stg_[0-9a-f]{32}",
+		"Internal Token": "itk_[0-9a-f]{32}",
+	}
+	if !reflect.DeepEqual(patterns, want) {
+		t.Errorf("truffleHog rules = %v, want %v", patterns, want)
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, repoConfigName), []byte("rules:\n  Internal Token: {pattern: itk_, severity: urgent}\n"), 0644)
+	if _, err := loadRepoConfig(dir); err == nil {
+		t.Error("the invalid severity was accepted")
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"strings"
+)
+
+// The token is handed to git through GIT_ASKPASS, reading it from the environment of the
+// git process, so that it never shows up in the process arguments or in .git/config.
+const askpassScriptContent = `#!/bin/sh
+case "$1" in
+Username*) echo "x-access-token" ;;
+*) echo "$GAS_GIT_TOKEN" ;;
+esac
+`
+
+var askpassScript string
+
+// setupAskpass writes the askpass script when cloning over HTTPS. The returned function removes it.
+func setupAskpass() (func(), error) {
+	if *cloneProtocol != "https" {
+		return func() {}, nil
+	}
+
+	script, err := writeScript("git-all-secrets-askpass", askpassScriptContent)
+	if err != nil {
+		return nil, err
+	}
+	askpassScript = script
+
+	return func() { os.Remove(askpassScript) }, nil
+}
+
+// gitToken is the token used to clone over HTTPS
+func gitToken() string {
+	if appTokens != nil {
+		t, err := appTokens.Token()
+		if err != nil {
+			Info("%v\n", err)
+			return ""
+		}
+		return t.AccessToken
+	}
+	if apiTokens != nil {
+		return apiTokens.token()
+	}
+	return *token
+}
+
+// gitEnv is the environment of every git process, including the ones started by the scanners
+func gitEnv() []string {
+	env := append(os.Environ(), "GIT_SSH_COMMAND="+sshCommand())
+	env = append(env, sshAgentEnv...)
+	if askpassScript != "" {
+		env = append(env,
+			"GIT_ASKPASS="+askpassScript,
+			"GAS_GIT_TOKEN="+gitToken(),
+			"GIT_TERMINAL_PROMPT=0",
+		)
+	}
+	return env
+}
+
+// gitConfigArgs makes sure git does not use or store credentials from any configured helper
+func gitConfigArgs() []string {
+	if askpassScript == "" {
+		return nil
+	}
+	return []string{"-c", "credential.helper="}
+}
+
+// httpsURL turns an SSH clone URL such as git@github.com:org/repo.git or
+// ssh://git@host:2222/org/repo.git into its HTTPS form
+func httpsURL(cloneURL string) string {
+	if strings.HasPrefix(cloneURL, "git@") {
+		hostAndPath := strings.SplitN(strings.TrimPrefix(cloneURL, "git@"), ":", 2)
+		if len(hostAndPath) == 2 {
+			return "https://" + hostAndPath[0] + "/" + hostAndPath[1]
+		}
+	}
+	if strings.HasPrefix(cloneURL, "ssh://") {
+		// The port of the SSH server, if any, is not the one of the HTTPS server
+		u, err := url.Parse(cloneURL)
+		if err != nil {
+			return cloneURL
+		}
+		host := u.Hostname()
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		return (&url.URL{Scheme: "https", Host: host, Path: u.Path}).String()
+	}
+	return cloneURL
+}
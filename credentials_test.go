@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestHTTPSURL(t *testing.T) {
+	tests := []struct {
+		url   string
+		https string
+	}{
+		{"git@github.com:acme/api.git", "https://github.com/acme/api.git"},
+		{"git@github.example.com:acme/api.git", "https://github.example.com/acme/api.git"},
+		{"ssh://git@github.com/acme/api.git", "https://github.com/acme/api.git"},
+		{"ssh://github.com/acme/api.git", "https://github.com/acme/api.git"},
+		{"ssh://git@github.example.com:2222/acme/api.git", "https://github.example.com/acme/api.git"},
+		{"ssh://git@[::1]:2222/acme/api.git", "https://[::1]/acme/api.git"},
+		{"https://github.com/acme/api.git", "https://github.com/acme/api.git"},
+		{"git@github.com", "git@github.com"},
+	}
+	for _, test := range tests {
+		if https := httpsURL(test.url); https != test.https {
+			t.Errorf("httpsURL(%q) = %q, want %q", test.url, https, test.https)
+		}
+	}
+}
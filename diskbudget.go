@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// diskBudget keeps the working copies of the pipeline within the maxDisk flag. A clone reserves
+// the size Github reports for the repo before it starts, the reservation is corrected with the
+// size the clone actually takes once it is done and it is freed when the clone is deleted. The
+// mirrors of the cacheDir flag are kept from run to run, so they are not part of the budget.
+type diskBudget struct {
+	mutex sync.Mutex
+	freed *sync.Cond
+	max   int64
+	used  int64
+	// repos holding a reservation that are still in the pipeline, which might free some space
+	pending int
+}
+
+// clonesDisk is nil when there is no maxDisk budget
+var clonesDisk *diskBudget
+
+func newDiskBudget(max int64) *diskBudget {
+	if max <= 0 {
+		return nil
+	}
+	b := &diskBudget{max: max}
+	b.freed = sync.NewCond(&b.mutex)
+	return b
+}
+
+var sizeUnits = map[string]int64{"": 1, "K": 1 << 10, "M": 1 << 20, "G": 1 << 30, "T": 1 << 40}
+
+// parseSize parses sizes such as 500M or 20G, in bytes when there is no unit
+func parseSize(size string) (int64, error) {
+	if size == "" {
+		return 0, nil
+	}
+	number := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(size)), "B")
+	unit := strings.TrimLeft(number, "0123456789")
+	multiplier, ok := sizeUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit in %s, use K, M, G or T", size)
+	}
+	n, err := strconv.ParseInt(strings.TrimSuffix(number, unit), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %s", size)
+	}
+	return n * multiplier, nil
+}
+
+func formatSize(size int64) string {
+	for _, unit := range []string{"T", "G", "M", "K"} {
+		if size >= sizeUnits[unit] {
+			return strconv.FormatFloat(float64(size)/float64(sizeUnits[unit]), 'f', 1, 64) + unit
+		}
+	}
+	return strconv.FormatInt(size, 10) + "B"
+}
+
+// dirSize is the size of the files under dir
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// Reserved for the repos whose size is not known before they are cloned, such as gists and
+// the repoURL flag, until the reservation is corrected with the size of the clone
+const unknownRepoSize = 100 << 20
+
+// estimate is the size to reserve for a repo Github reports the given size for. The unknown
+// sizes are estimated conservatively, but never over the whole budget.
+func (b *diskBudget) estimate(size int64) int64 {
+	if b == nil || size > 0 {
+		return size
+	}
+	if b.max < unknownRepoSize {
+		return b.max
+	}
+	return unknownRepoSize
+}
+
+// reserve waits until a clone of the given size fits in the budget. It fails right away when
+// the repo is larger than the whole budget, and when the budget is used up by clones that are
+// kept once every repo in the pipeline is done with.
+func (b *diskBudget) reserve(size int64) error {
+	if b == nil {
+		return nil
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if size > b.max {
+		return fmt.Errorf("the repo takes %s, more than the maxDisk budget of %s", formatSize(size), formatSize(b.max))
+	}
+	for b.used+size > b.max {
+		if b.pending == 0 || interrupted() {
+			return fmt.Errorf("the maxDisk budget of %s is used up by the clones that are kept", formatSize(b.max))
+		}
+		b.freed.Wait()
+	}
+	b.used += size
+	b.pending++
+	return nil
+}
+
+// measure corrects the reservation of a clone with the size it actually takes on the disk
+func (b *diskBudget) measure(actual int64, reserved int64) {
+	if b == nil {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.used += actual - reserved
+	b.freed.Broadcast()
+}
+
+// claim reserves the space taken by a repo that is already cloned, even over the budget
+func (b *diskBudget) claim(size int64) {
+	if b == nil {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.used += size
+	b.pending++
+}
+
+// release ends the reservation of a repo leaving the pipeline. Its space is only freed when
+// its working copy was deleted.
+func (b *diskBudget) release(size int64, deleted bool) {
+	if b == nil {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if deleted {
+		b.used -= size
+	}
+	b.pending--
+	b.freed.Broadcast()
+}
@@ -0,0 +1,110 @@
+package main
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		size  string
+		bytes int64
+		fails bool
+	}{
+		{"", 0, false},
+		{"1024", 1024, false},
+		{"500M", 500 << 20, false},
+		{"500MB", 500 << 20, false},
+		{"20g", 20 << 30, false},
+		{" 2T ", 2 << 40, false},
+		{"10K", 10 << 10, false},
+		{"1.5G", 0, true},
+		{"10X", 0, true},
+		{"G", 0, true},
+		{"-5M", 0, true},
+	}
+	for _, test := range tests {
+		bytes, err := parseSize(test.size)
+		if (err != nil) != test.fails || bytes != test.bytes {
+			t.Errorf("parseSize(%q) = %d, %v", test.size, bytes, err)
+		}
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		bytes int64
+		size  string
+	}{
+		{0, "0B"},
+		{1023, "1023B"},
+		{1024, "1.0K"},
+		{1536 << 20, "1.5G"},
+		{3 << 40, "3.0T"},
+	}
+	for _, test := range tests {
+		if size := formatSize(test.bytes); size != test.size {
+			t.Errorf("formatSize(%d) = %q, want %q", test.bytes, size, test.size)
+		}
+	}
+}
+
+// A clone waits for the space freed by the others and fails once no clone can free any
+func TestDiskBudgetReserve(t *testing.T) {
+	b := newDiskBudget(100)
+	if err := b.reserve(150); err == nil {
+		t.Error("a repo larger than the budget was reserved")
+	}
+	if err := b.reserve(60); err != nil {
+		t.Fatal(err)
+	}
+
+	reserved := make(chan error)
+	go func() { reserved <- b.reserve(60) }()
+	b.measure(50, 60)
+	b.release(50, true)
+	if err := <-reserved; err != nil {
+		t.Fatal(err)
+	}
+
+	// The clone is kept, so nothing can free the space anymore
+	b.release(60, false)
+	if err := b.reserve(60); err == nil {
+		t.Error("the reservation did not fail with the budget used up by kept clones")
+	}
+	if newDiskBudget(0) != nil {
+		t.Error("a budget of 0 is not unlimited")
+	}
+}
+
+// The repos whose size is unknown, such as gists, reserve an estimate until they are cloned
+func TestDiskBudgetUnknownSizes(t *testing.T) {
+	b := newDiskBudget(150 << 20)
+	first := b.estimate(0)
+	if first != unknownRepoSize {
+		t.Fatalf("estimate(0) = %d, want %d", first, unknownRepoSize)
+	}
+	if err := b.reserve(first); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second gist waits until the first one turns out to be small
+	reserved := make(chan error)
+	go func() { reserved <- b.reserve(b.estimate(0)) }()
+	select {
+	case <-reserved:
+		t.Fatal("the second gist was reserved over the budget")
+	default:
+	}
+	b.measure(1<<20, first)
+	if err := <-reserved; err != nil {
+		t.Fatal(err)
+	}
+
+	if size := b.estimate(5 << 20); size != 5<<20 {
+		t.Errorf("estimate of a known size = %d", size)
+	}
+	if size := newDiskBudget(10 << 20).estimate(0); size != 10<<20 {
+		t.Errorf("estimate over a small budget = %d, want the whole budget", size)
+	}
+	if size := (*diskBudget)(nil).estimate(0); size != 0 {
+		t.Errorf("estimate without a budget = %d", size)
+	}
+}
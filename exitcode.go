@@ -0,0 +1,47 @@
+package main
+
+import "fmt"
+
+// Exit codes, so that CI pipelines can gate on the result of the scan
+const (
+	// No findings at or above the failOn severity and every repo was scanned
+	exitClean = 0
+	// Findings at or above the failOn severity, whether or not every repo was scanned
+	exitFindings = 1
+	// Invalid flags or a fatal error, in which case no output is written
+	exitFatal = 2
+	// No findings at or above the failOn severity but some repos could not be scanned
+	exitPartial = 3
+)
+
+// failing counts the findings at or above the failOn severity
+func failing(findings []finding, failOn string) int {
+	if failOn == "none" {
+		return 0
+	}
+
+	count := 0
+	for _, f := range findings {
+		if severityRank(f.Severity) >= severityRank(failOn) {
+			count++
+		}
+	}
+	return count
+}
+
+func exitCode(findings []finding, failOn string, failed int) int {
+	if failing(findings, failOn) > 0 {
+		return exitFindings
+	}
+	if failed > 0 {
+		return exitPartial
+	}
+	return exitClean
+}
+
+// fatal prints an error that stops the scan. run returns the exit code rather than exiting,
+// so that its deferred cleanups still run.
+func fatal(err error) int {
+	fmt.Fprintln(console, "Error:", err)
+	return exitFatal
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// finding is a single secret reported by one of the scanning tools, normalized
+// so that every output format can be rendered from the same data.
+type finding struct {
+	Host             string `json:"host"`
+	OrgOrUser        string `json:"orgOrUser"`
+	Kind             string `json:"kind"`
+	Repo             string `json:"repo"`
+	RepoURL          string `json:"repoURL"`
+	Tool             string `json:"tool"`
+	Rule             string `json:"rule"`
+	Severity         string `json:"severity"`
+	Path             string `json:"path"`
+	Branch           string `json:"branch,omitempty"`
+	Commit           string `json:"commit,omitempty"`
+	Hash             string `json:"commitHash,omitempty"`
+	Date             string `json:"date,omitempty"`
+	Diff             string `json:"diff,omitempty"`
+	Secret           string `json:"secret"`
+	Fingerprint      string `json:"fingerprint"`
+	TruncatedHistory string `json:"truncatedHistory,omitempty"`
+}
+
+func (f finding) id() repoID {
+	return repoID{Host: f.Host, Owner: f.OrgOrUser, Kind: f.Kind, Name: f.Repo}
+}
+
+// Severities ordered from the least to the most severe
+var severities = []string{"low", "medium", "high", "critical"}
+
+// Default severity of the rules shipped in rules.json, unless the rules file sets one. Rules
+// that are not listed here (i.e. custom rules) are considered medium and entropy findings are low.
+var ruleSeverities = map[string]string{
+	"AWS API Key":               "critical",
+	"RSA private key":           "critical",
+	"SSH (DSA) private key":     "critical",
+	"SSH (EC) private key":      "critical",
+	"SSH (OPENSSH) private key": "critical",
+	"PGP private key block":     "critical",
+	"Private key":               "critical",
+	"GitHub":                    "high",
+	"GitHub 2":                  "high",
+	"Slack Token":               "high",
+	"Heroku API Key":            "high",
+	"Google Oauth":              "high",
+	"Google Oauth 2":            "high",
+	"Facebook Oauth":            "high",
+	"Facebook Oauth 2":          "high",
+	"Twitter Oauth":             "high",
+	"Twitter Oauth 2":           "high",
+}
+
+const entropyRule = "High Entropy"
+
+func ruleSeverity(rule string) string {
+	if severity := fileRules[rule].Severity; severity != "" {
+		return severity
+	}
+	if rule == entropyRule {
+		return "low"
+	}
+	if severity, ok := ruleSeverities[rule]; ok {
+		return severity
+	}
+	return "medium"
+}
+
+// resultFiles maps the toolName flag to the names of the result files written by the tools
+func resultFiles(tool string) []string {
+	switch tool {
+	case "thog", "truffleHog":
+		return []string{"truffleHog"}
+	case "repo-supervisor":
+		return []string{"repo-supervisor"}
+	}
+	return []string{"truffleHog", "repo-supervisor"}
+}
+
+// loadRepoFindings reads the results of every tool for the repository. A result file that
+// can't be read is recorded as a failure of the repo.
+func loadRepoFindings(id repoID, tool string) []finding {
+	var findings []finding
+
+	var url, truncated string
+	home := repoPath(id)
+	if home != "" {
+		url, _ = gitRepoURL(home)
+		truncated = truncatedHistory(home)
+	}
+
+	for _, toolname := range resultFiles(tool) {
+		outfile := resultPath(id, toolname)
+		if !fileExists(outfile) {
+			continue
+		}
+
+		var repoFindings []finding
+		var err error
+		switch toolname {
+		case "truffleHog":
+			repoFindings, err = parseThogFindings(outfile)
+		case "repo-supervisor":
+			repoFindings, err = parseReposupvFindings(outfile, home)
+		}
+		if err != nil {
+			Info("Reading the " + toolname + " results failed for: " + id.String())
+			fmt.Fprintln(console, err)
+			failures.record(ledgerEntry{Host: id.Host, OrgOrUser: id.Owner, Kind: id.Kind, Repo: id.Name, URL: url, Dir: cloneDir(id), Stage: "results", Tool: toolname, Error: err.Error()})
+			continue
+		}
+
+		for _, f := range repoFindings {
+			f.Host = id.Host
+			f.OrgOrUser = id.Owner
+			f.Kind = id.Kind
+			f.Repo = id.Name
+			f.RepoURL = url
+			f.TruncatedHistory = truncated
+			f.Fingerprint = f.fingerprint()
+			findings = append(findings, f)
+		}
+	}
+	return findings
+}
+
+// filterFindings drops the findings excluded by the path filters, the linguist attributes,
+// the configuration of the repos and their ignore files, and counts them as suppressed
+func filterFindings(findings []finding, suppressed map[string]int) []finding {
+	findings = applyPathFilters(findings, suppressed)
+	findings = applyRepoConfigs(findings, suppressed)
+	findings = applyLinguistAttributes(findings, *linguistFiles, suppressed)
+	return applyIgnores(findings, suppressed)
+}
+
+// savedFindingsFile keeps the filtered findings of a repo in its results directory once its
+// working copy is deleted, since the filters can't be applied again without it
+const savedFindingsFile = "findings.json"
+
+// repoFindings are the filtered findings of a repo along with how many were suppressed and why
+type repoFindings struct {
+	Findings   []finding      `json:"findings"`
+	Suppressed map[string]int `json:"suppressed"`
+}
+
+func saveFindings(id repoID, saved repoFindings) error {
+	content, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(resultPath(id, savedFindingsFile), content, 0644)
+}
+
+func loadSavedFindings(id repoID) (repoFindings, error) {
+	var saved repoFindings
+	content, err := ioutil.ReadFile(resultPath(id, savedFindingsFile))
+	if err != nil {
+		return saved, err
+	}
+	return saved, json.Unmarshal(content, &saved)
+}
+
+// findingsCollector gathers the filtered findings of the repos as they leave the pipeline,
+// along with how many findings were suppressed and why
+type findingsCollector struct {
+	mutex      sync.Mutex
+	findings   []finding
+	suppressed map[string]int
+	repos      map[repoID]bool
+}
+
+var collected = &findingsCollector{suppressed: make(map[string]int), repos: make(map[repoID]bool)}
+
+// add reads and filters the findings of a scanned repository
+func (c *findingsCollector) add(id repoID) repoFindings {
+	added := repoFindings{Suppressed: make(map[string]int)}
+	added.Findings = filterFindings(loadRepoFindings(id, *toolName), added.Suppressed)
+	c.merge(id, added)
+	return added
+}
+
+func (c *findingsCollector) merge(id repoID, added repoFindings) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.findings = append(c.findings, added.Findings...)
+	for reason, count := range added.Suppressed {
+		c.suppressed[reason] += count
+	}
+	c.repos[id] = true
+}
+
+// count is the number of findings collected so far
+func (c *findingsCollector) count() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.findings)
+}
+
+// report returns the findings of every scanned repository. The results in the resultsDir that
+// did not go through the pipeline of this run, such as the ones of the repos that did not fail
+// when retrying failures, are read and filtered as well, or read from the findings saved when
+// their working copy was deleted.
+func (c *findingsCollector) report() ([]finding, map[string]int) {
+	for _, id := range scannedRepos() {
+		c.mutex.Lock()
+		added := c.repos[id]
+		c.mutex.Unlock()
+		if added {
+			continue
+		}
+
+		if repoPath(id) == "" && fileExists(resultPath(id, savedFindingsFile)) {
+			saved, err := loadSavedFindings(id)
+			if err == nil {
+				c.merge(id, saved)
+				continue
+			}
+			Info("Reading the saved findings failed for: " + id.String())
+			fmt.Fprintln(console, err)
+		}
+		c.add(id)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	findings := append([]finding(nil), c.findings...)
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].id().less(findings[j].id())
+	})
+	return findings, c.suppressed
+}
+
+// scannedRepos lists the repos that have results, in <resultsDir>/<host>/<owner>/<kind>/<name>
+func scannedRepos() []repoID {
+	var ids []repoID
+	hosts, _ := ioutil.ReadDir(resultsDir)
+	for _, host := range hosts {
+		owners, _ := ioutil.ReadDir(filepath.Join(resultsDir, host.Name()))
+		for _, owner := range owners {
+			kinds, _ := ioutil.ReadDir(filepath.Join(resultsDir, host.Name(), owner.Name()))
+			for _, kind := range kinds {
+				names, _ := ioutil.ReadDir(filepath.Join(resultsDir, host.Name(), owner.Name(), kind.Name()))
+				for _, name := range names {
+					ids = append(ids, repoID{Host: host.Name(), Owner: owner.Name(), Kind: kind.Name(), Name: name.Name()})
+				}
+			}
+		}
+	}
+	return ids
+}
+
+func parseThogFindings(outfile string) ([]finding, error) {
+	var findings []finding
+
+	file, err := os.Open(outfile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Every line is one JSON object and diffs of big commits can be huge
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 256*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var issue truffleHogOutput
+		if err := json.Unmarshal([]byte(line), &issue); err != nil {
+			return nil, err
+		}
+		for _, str := range issue.StringsFound {
+			findings = append(findings, finding{
+				Tool:     "truffleHog",
+				Rule:     issue.Reason,
+				Severity: ruleSeverity(issue.Reason),
+				Path:     issue.Path,
+				Branch:   issue.Branch,
+				Commit:   strings.TrimSpace(issue.Commit),
+				Hash:     issue.CommitHash,
+				Date:     issue.Date,
+				Diff:     issue.Diff,
+				Secret:   str,
+			})
+		}
+	}
+	return findings, scanner.Err()
+}
+
+func parseReposupvFindings(outfile string, home string) ([]finding, error) {
+	results, err := loadReposupvOut(outfile, home)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []finding
+	for path, stringsFound := range results {
+		for _, str := range stringsFound {
+			findings = append(findings, finding{
+				Tool:     "repo-supervisor",
+				Rule:     entropyRule,
+				Severity: ruleSeverity(entropyRule),
+				Path:     path,
+				Secret:   str,
+			})
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Path < findings[j].Path
+	})
+	return findings, nil
+}
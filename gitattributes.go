@@ -0,0 +1,131 @@
+package main
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+// Vendored and generated code that teams already tag with linguist-vendored and
+// linguist-generated in their .gitattributes is handled according to the linguistFiles flag.
+const linguistReason = "linguist-vendored/generated"
+
+type attributeLine struct {
+	pattern    string
+	attributes map[string]bool
+}
+
+// gitattributes reads .gitattributes files, either at a given commit or from the working tree
+type gitattributes struct {
+	home  string
+	files map[string][]attributeLine
+}
+
+func newGitattributes(home string) *gitattributes {
+	return &gitattributes{home: home, files: make(map[string][]attributeLine)}
+}
+
+func parseGitattributes(content string) []attributeLine {
+	var lines []attributeLine
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		attributes := make(map[string]bool)
+		for _, attr := range fields[1:] {
+			switch {
+			case strings.HasPrefix(attr, "-") || strings.HasPrefix(attr, "!"):
+				attributes[attr[1:]] = false
+			case strings.HasSuffix(attr, "=false"):
+				attributes[strings.TrimSuffix(attr, "=false")] = false
+			default:
+				attributes[strings.SplitN(attr, "=", 2)[0]] = true
+			}
+		}
+		lines = append(lines, attributeLine{pattern: fields[0], attributes: attributes})
+	}
+	return lines
+}
+
+// read returns the lines of the .gitattributes in dir at the commit, or in the working tree
+// if there is no commit
+func (g *gitattributes) read(commit string, dir string) []attributeLine {
+	key := commit + ":" + dir
+	if lines, ok := g.files[key]; ok {
+		return lines
+	}
+
+	var content []byte
+	if commit != "" {
+		cmd := exec.Command(*gitPath, "-C", g.home, "show", commit+":"+dir+".gitattributes")
+		cmd.Env = gitEnv()
+		content, _ = cmd.Output()
+	} else {
+		content, _ = ioutil.ReadFile(g.home + "/" + dir + ".gitattributes")
+	}
+
+	lines := parseGitattributes(string(content))
+	g.files[key] = lines
+	return lines
+}
+
+// linguistFile reports whether the file is tagged as vendored or generated at the commit.
+// The .gitattributes files closer to the file take precedence, and so do later lines.
+func (g *gitattributes) linguistFile(commit string, file string) bool {
+	dirs := []string{""}
+	if dir := path.Dir(file); dir != "." {
+		parts := strings.Split(dir, "/")
+		for i := range parts {
+			dirs = append(dirs, strings.Join(parts[:i+1], "/")+"/")
+		}
+	}
+
+	tagged := make(map[string]bool)
+	for _, dir := range dirs {
+		relative := strings.TrimPrefix(file, dir)
+		for _, line := range g.read(commit, dir) {
+			if !matchPath(line.pattern, relative) {
+				continue
+			}
+			for _, attr := range []string{"linguist-vendored", "linguist-generated"} {
+				if value, ok := line.attributes[attr]; ok {
+					tagged[attr] = value
+				}
+			}
+		}
+	}
+	return tagged["linguist-vendored"] || tagged["linguist-generated"]
+}
+
+// applyLinguistAttributes skips or down-ranks the findings in files tagged as vendored or
+// generated at the commit they were found in
+func applyLinguistAttributes(findings []finding, mode string, suppressed map[string]int) []finding {
+	if mode == "scan" {
+		return findings
+	}
+
+	attributes := make(map[string]*gitattributes)
+
+	var kept []finding
+	for _, f := range findings {
+		home := repoPath(f.id())
+		g, ok := attributes[home]
+		if !ok {
+			g = newGitattributes(home)
+			attributes[home] = g
+		}
+
+		if home == "" || !g.linguistFile(f.Hash, f.Path) {
+			kept = append(kept, f)
+		} else if mode == "downrank" {
+			f.Severity = "low"
+			kept = append(kept, f)
+		} else {
+			suppressed[linguistReason]++
+		}
+	}
+	return kept
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseGitattributes(t *testing.T) {
+	content := `# generated code
+*.pb.go linguist-generated=true
+vendor/** linguist-vendored
+third_party/** -linguist-vendored
+docs/** !linguist-documentation linguist-vendored=false
+*.txt text eol=lf
+lonely-pattern
+`
+	want := []attributeLine{
+		{"*.pb.go", map[string]bool{"linguist-generated": true}},
+		{"vendor/**", map[string]bool{"linguist-vendored": true}},
+		{"third_party/**", map[string]bool{"linguist-vendored": false}},
+		{"docs/**", map[string]bool{"linguist-documentation": false, "linguist-vendored": false}},
+		{"*.txt", map[string]bool{"text": true, "eol": true}},
+	}
+	if got := parseGitattributes(content); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseGitattributes = %+v, want %+v", got, want)
+	}
+}
+
+func TestLinguistFile(t *testing.T) {
+	home, err := ioutil.TempDir("", "git-all-secrets-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	os.MkdirAll(filepath.Join(home, "lib", "keep"), 0700)
+	ioutil.WriteFile(filepath.Join(home, ".gitattributes"), []byte("lib/** linguist-vendored\n*.pb.go linguist-generated\n"), 0644)
+	ioutil.WriteFile(filepath.Join(home, "lib", "keep", ".gitattributes"), []byte("* -linguist-vendored\n"), 0644)
+
+	tests := []struct {
+		file   string
+		tagged bool
+	}{
+		{"main.go", false},
+		{"lib/a.js", true},
+		{"lib/keep/b.js", false},
+		{"api/api.pb.go", true},
+		{"lib/keep/c.pb.go", true},
+	}
+	g := newGitattributes(home)
+	for _, test := range tests {
+		if tagged := g.linguistFile("", test.file); tagged != test.tagged {
+			t.Errorf("linguistFile(%q) = %v, want %v", test.file, tagged, test.tagged)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/google/go-github/github"
+)
+
+// Installation tokens are valid for an hour and are refreshed this long before they expire,
+// so that a clone or an API call started with a token does not outlive it
+const appTokenRefreshMargin = 5 * time.Minute
+
+// appTokens hands out the installation token when authenticating as a Github App
+var appTokens oauth2.TokenSource
+
+func loadAppPrivateKey(file string) (*rsa.PrivateKey, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not a PEM encoded private key", file)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not an RSA private key: %v", file, err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an RSA private key", file)
+	}
+	return rsaKey, nil
+}
+
+// appJWT signs the short lived JWT the app authenticates with to the app endpoints of the API
+func appJWT(appID int64, key *rsa.PrivateKey) (string, error) {
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		// backdated in case the clock of the API server is slightly behind
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": strconv.FormatInt(appID, 10),
+	})
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	hash := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// appTransport authenticates every request with a freshly signed JWT
+type appTransport struct {
+	appID int64
+	key   *rsa.PrivateKey
+}
+
+func (t *appTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	jwt, err := appJWT(t.appID, t.key)
+	if err != nil {
+		return nil, err
+	}
+	// a RoundTripper must not modify the request it is given
+	authenticated := *req
+	authenticated.Header = cloneHeader(req.Header)
+	authenticated.Header.Set("Authorization", "Bearer "+jwt)
+	// the app endpoints are still in preview on older Github Enterprise versions
+	authenticated.Header.Set("Accept", "application/vnd.github.machine-man-preview+json")
+	return http.DefaultTransport.RoundTrip(&authenticated)
+}
+
+func cloneHeader(header http.Header) http.Header {
+	clone := make(http.Header, len(header))
+	for k, v := range header {
+		clone[k] = append([]string(nil), v...)
+	}
+	return clone
+}
+
+// installationTokenSource exchanges the JWT of the app for a token of one of its installations
+type installationTokenSource struct {
+	client         *github.Client
+	installationID int64
+}
+
+func (s *installationTokenSource) Token() (*oauth2.Token, error) {
+	// The endpoint of the go-github version in use was moved under app/ by Github
+	req, err := s.client.NewRequest("POST", fmt.Sprintf("app/installations/%d/access_tokens", s.installationID), nil)
+	if err != nil {
+		return nil, err
+	}
+	token := new(github.InstallationToken)
+	if _, err := s.client.Do(context.Background(), req, token); err != nil {
+		return nil, fmt.Errorf("could not get a token for installation %d: %v", s.installationID, err)
+	}
+	Info("Got a token for installation %d valid until %s\n", s.installationID, token.GetExpiresAt().Format(time.RFC3339))
+	return &oauth2.Token{
+		AccessToken: token.GetToken(),
+		Expiry:      token.GetExpiresAt().Add(-appTokenRefreshMargin),
+	}, nil
+}
+
+// scannedOwner is the org or user that is scanned, used to pick the installation of the app
+func scannedOwner() string {
+	if *org != "" {
+		return *org
+	}
+	if *user != "" {
+		return *user
+	}
+	u := *repoURL
+	if u == "" {
+		u = *gistURL
+	}
+	if i := strings.Index(u, "://"); i >= 0 {
+		u = u[i+3:]
+	} else {
+		// git@github.com:org/repo.git
+		u = strings.Replace(u, ":", "/", 1)
+	}
+	parts := strings.Split(u, "/")
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+func findInstallation(ctx context.Context, client *github.Client, owner string) (int64, error) {
+	var installations []*github.Installation
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		page, resp, err := client.Apps.ListInstallations(ctx, opt)
+		if err != nil {
+			return 0, fmt.Errorf("could not list the installations of the app: %v", err)
+		}
+		installations = append(installations, page...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	for _, installation := range installations {
+		if owner != "" && strings.EqualFold(installation.GetAccount().GetLogin(), owner) {
+			return installation.GetID(), nil
+		}
+	}
+	if len(installations) == 1 && owner == "" {
+		return installations[0].GetID(), nil
+	}
+	if owner != "" {
+		return 0, fmt.Errorf("the app is not installed on %s", owner)
+	}
+	return 0, errors.New("the app has several installations. Please provide the one to use with the appInstallationID flag")
+}
+
+// setupGithubApp authenticates as a Github App when the appID flag is provided. The API calls
+// and the HTTPS clones then use a token of the installation of the app on the scanned org or
+// user, refreshed before it expires.
+func setupGithubApp(ctx context.Context) error {
+	if *appID == 0 {
+		return nil
+	}
+
+	key, err := loadAppPrivateKey(*appPrivateKey)
+	if err != nil {
+		return err
+	}
+	client, err := newGithubClient(&http.Client{Transport: &appTransport{appID: *appID, key: key}})
+	if err != nil {
+		return err
+	}
+
+	installationID := *appInstallationID
+	if installationID == 0 {
+		installationID, err = findInstallation(ctx, client, scannedOwner())
+		if err != nil {
+			return err
+		}
+	}
+	Info("Authenticating as installation %d of the Github App %d\n", installationID, *appID)
+
+	appTokens = oauth2.ReuseTokenSource(nil, &installationTokenSource{client: client, installationID: installationID})
+	_, err = appTokens.Token()
+	return err
+}
+
+// listInstallationRepos lists the repositories the installation of the app has access to
+func listInstallationRepos(ctx context.Context, client *github.Client) ([]*repository, error) {
+	var allRepos []*repository
+	params := url.Values{"per_page": {"100"}}
+
+	for {
+		req, err := client.NewRequest("GET", "installation/repositories?"+params.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/vnd.github.machine-man-preview+json, application/vnd.github.mercy-preview+json, application/vnd.github.nebula-preview+json")
+
+		var page struct {
+			Repositories []*repository `json:"repositories"`
+		}
+		resp, err := client.Do(ctx, req, &page)
+		if err != nil {
+			return nil, err
+		}
+		allRepos = append(allRepos, page.Repositories...)
+		if resp.NextPage == 0 {
+			break
+		}
+		params.Set("page", strconv.Itoa(resp.NextPage))
+	}
+
+	return allRepos, nil
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// verifyJWT checks that the request is authenticated with a JWT of the app signed by the key
+func verifyJWT(r *http.Request, key *rsa.PrivateKey, appID string) error {
+	jwt := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("not a JWT: %q", r.Header.Get("Authorization"))
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, hash[:], signature); err != nil {
+		return fmt.Errorf("invalid signature: %v", err)
+	}
+
+	content, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return err
+	}
+	var claims struct {
+		Iss string `json:"iss"`
+		Iat int64  `json:"iat"`
+		Exp int64  `json:"exp"`
+	}
+	if err := json.Unmarshal(content, &claims); err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	if claims.Iss != appID || claims.Iat > now || claims.Exp <= now || claims.Exp-claims.Iat > 600 {
+		return fmt.Errorf("invalid claims: %s", content)
+	}
+	return nil
+}
+
+// githubAppServer is a stand-in Github Enterprise API for the app endpoints. The first
+// installation token it hands out is about to expire, the next ones are valid for an hour.
+type githubAppServer struct {
+	mutex     sync.Mutex
+	key       *rsa.PrivateKey
+	exchanges int
+	errors    []string
+	repoToken string
+}
+
+func (s *githubAppServer) fail(format string, args ...interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.errors = append(s.errors, fmt.Sprintf(format, args...))
+}
+
+func (s *githubAppServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, "/api/v3/") {
+		s.fail("%s is not under the Enterprise base URL", r.URL.Path)
+		http.NotFound(w, r)
+		return
+	}
+	switch path := strings.TrimPrefix(r.URL.Path, "/api/v3"); {
+	case r.Method == "GET" && path == "/app/installations":
+		if err := verifyJWT(r, s.key, "42"); err != nil {
+			s.fail("listing the installations: %v", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `[{"id": 7, "account": {"login": "other"}}, {"id": 8, "account": {"login": "Acme"}}]`)
+
+	case r.Method == "POST" && path == "/app/installations/8/access_tokens":
+		if err := verifyJWT(r, s.key, "42"); err != nil {
+			s.fail("exchanging the JWT: %v", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		s.mutex.Lock()
+		s.exchanges++
+		exchange := s.exchanges
+		s.mutex.Unlock()
+		expiresAt := time.Now().Add(time.Hour)
+		if exchange == 1 {
+			expiresAt = time.Now().Add(appTokenRefreshMargin / 2)
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token": "installation-token-%d", "expires_at": %q}`, exchange, expiresAt.Format(time.RFC3339))
+
+	case r.Method == "GET" && path == "/installation/repositories":
+		s.mutex.Lock()
+		s.repoToken = r.Header.Get("Authorization")
+		s.mutex.Unlock()
+		fmt.Fprint(w, `{"total_count": 1, "repositories": [{"name": "api", "owner": {"login": "Acme"}}]}`)
+
+	default:
+		s.fail("unexpected request %s %s", r.Method, r.URL.Path)
+		http.NotFound(w, r)
+	}
+}
+
+func TestSetupGithubApp(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile, err := ioutil.TempFile("", "git-all-secrets-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(keyFile.Name())
+	pem.Encode(keyFile, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	keyFile.Close()
+
+	api := &githubAppServer{key: key}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	defer func(id int64, file string, installation int64, owner string, enterprise string) {
+		*appID, *appPrivateKey, *appInstallationID, *org, *enterpriseURL = id, file, installation, owner, enterprise
+		appTokens = nil
+	}(*appID, *appPrivateKey, *appInstallationID, *org, *enterpriseURL)
+	*appID = 42
+	*appPrivateKey = keyFile.Name()
+	*appInstallationID = 0
+	*org = "acme"
+	*enterpriseURL = server.URL + "/api/v3/"
+
+	ctx := context.Background()
+	if err := setupGithubApp(ctx); err != nil {
+		t.Fatal(err)
+	}
+	client, err := authenticatetogit(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first token expires within the refresh margin, so it is exchanged again before use
+	repos, err := listInstallationRepos(ctx, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 1 || repos[0].GetName() != "api" {
+		t.Errorf("got %d repos", len(repos))
+	}
+	if api.repoToken != "Bearer installation-token-2" {
+		t.Errorf("the repos were listed with %q, want the refreshed token", api.repoToken)
+	}
+	if token := gitToken(); token != "installation-token-2" {
+		t.Errorf("cloning with %q, want the refreshed token", token)
+	}
+	if _, err := listInstallationRepos(ctx, client); err != nil {
+		t.Fatal(err)
+	}
+	if api.exchanges != 2 {
+		t.Errorf("the JWT was exchanged %d times, want 2", api.exchanges)
+	}
+	for _, e := range api.errors {
+		t.Error(e)
+	}
+}
+
+func TestFindInstallation(t *testing.T) {
+	tests := []struct {
+		installations string
+		owner         string
+		id            int64
+		fails         bool
+	}{
+		{`[{"id": 7, "account": {"login": "other"}}, {"id": 8, "account": {"login": "Acme"}}]`, "acme", 8, false},
+		{`[{"id": 7, "account": {"login": "other"}}]`, "acme", 0, true},
+		{`[{"id": 7, "account": {"login": "other"}}]`, "", 7, false},
+		{`[{"id": 7, "account": {"login": "other"}}, {"id": 8, "account": {"login": "Acme"}}]`, "", 0, true},
+	}
+	for _, test := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, test.installations)
+		}))
+		func() {
+			defer server.Close()
+			defer func(enterprise string) { *enterpriseURL = enterprise }(*enterpriseURL)
+			*enterpriseURL = server.URL + "/api/v3/"
+
+			client, err := newGithubClient(&http.Client{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			id, err := findInstallation(context.Background(), client, test.owner)
+			if (err != nil) != test.fails || id != test.id {
+				t.Errorf("findInstallation(%s, %q) = %d, %v", test.installations, test.owner, id, err)
+			}
+		}()
+	}
+}
+
+func TestScannedOwner(t *testing.T) {
+	tests := []struct {
+		org, user, repo, gist string
+		owner                 string
+	}{
+		{"acme", "", "", "", "acme"},
+		{"", "jdoe", "", "", "jdoe"},
+		{"", "", "https://github.com/acme/api.git", "", "acme"},
+		{"", "", "git@github.example.com:acme/api.git", "", "acme"},
+		{"", "", "", "https://gist.github.com/jdoe/0123abcd", "jdoe"},
+		{"", "", "api", "", ""},
+	}
+	defer func(o, u, r, g string) { *org, *user, *repoURL, *gistURL = o, u, r, g }(*org, *user, *repoURL, *gistURL)
+	for _, test := range tests {
+		*org, *user, *repoURL, *gistURL = test.org, test.user, test.repo, test.gist
+		if owner := scannedOwner(); owner != test.owner {
+			t.Errorf("scannedOwner() = %q with %+v, want %q", owner, test, test.owner)
+		}
+	}
+}
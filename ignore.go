@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Developers can mark intentional test fixtures as non-secrets, either with a trailing
+// gas:allow comment on the line of the secret or by listing paths and fingerprints in
+// a .gitallsecretsignore file at the root of the repo.
+const (
+	allowAnnotation = "gas:allow"
+	ignoreFileName  = ".gitallsecretsignore"
+)
+
+var fingerprintRegexp = regexp.MustCompile("^[0-9a-f]{64}$")
+
+type ignoreFile struct {
+	paths        []string
+	fingerprints map[string]bool
+}
+
+// loadIgnoreFile reads the .gitallsecretsignore of the repo cloned in home. There is none when
+// the repo has no working copy, rather than the one of the current directory.
+func loadIgnoreFile(home string) (*ignoreFile, error) {
+	ignores := &ignoreFile{fingerprints: make(map[string]bool)}
+	if home == "" {
+		return ignores, nil
+	}
+
+	file, err := os.Open(filepath.Join(home, ignoreFileName))
+	if os.IsNotExist(err) {
+		return ignores, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if fingerprintRegexp.MatchString(line) {
+			ignores.fingerprints[line] = true
+		} else {
+			ignores.paths = append(ignores.paths, line)
+		}
+	}
+	return ignores, scanner.Err()
+}
+
+// covers tells whether the finding is listed in the ignore file. Like the excludePaths of the
+// repo, its paths can't hide the findings of the locked rules, but a fingerprint acknowledges
+// one finding that was already reported and still applies to them.
+func (ignores *ignoreFile) covers(f finding) bool {
+	if ignores.fingerprints[f.fingerprint()] {
+		return true
+	}
+	if orgSettings.locked(f.Rule) {
+		return false
+	}
+	for _, pattern := range ignores.paths {
+		if matchPath(pattern, f.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// annotated reports whether a line containing the secret carries the gas:allow annotation,
+// either in the diff of the commit the secret was found in or in the file itself. Only the added
+// and context lines of the diff count, since a removed line does not say anything about the
+// secret that is still there.
+func annotated(f finding, home string) bool {
+	if f.Secret == "" {
+		return false
+	}
+
+	var lines []string
+	if f.Diff != "" {
+		for _, line := range strings.Split(f.Diff, "\n") {
+			if strings.HasPrefix(line, "+++") {
+				continue
+			}
+			if strings.HasPrefix(line, "+") || strings.HasPrefix(line, " ") {
+				lines = append(lines, line[1:])
+			}
+		}
+	} else if home != "" {
+		file, err := ioutil.ReadFile(filepath.Join(home, f.Path))
+		if err != nil {
+			return false
+		}
+		lines = strings.Split(string(file), "\n")
+	}
+
+	for _, line := range lines {
+		if strings.Contains(line, f.Secret) && strings.Contains(line, allowAnnotation) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyIgnores drops the findings covered by inline annotations or by the .gitallsecretsignore
+// file of their repo and counts them as suppressed
+func applyIgnores(findings []finding, suppressed map[string]int) []finding {
+	ignoreFiles := make(map[string]*ignoreFile)
+
+	var kept []finding
+	for _, f := range findings {
+		home := repoPath(f.id())
+
+		ignores, ok := ignoreFiles[home]
+		if !ok {
+			var err error
+			ignores, err = loadIgnoreFile(home)
+			if err != nil {
+				// The findings of the repo are reported rather than risking to hide some
+				Info("Ignoring the unreadable " + ignoreFileName + " of: " + f.id().String())
+				fmt.Fprintln(console, err)
+				failures.record(ledgerEntry{Host: f.Host, OrgOrUser: f.OrgOrUser, Kind: f.Kind, Repo: f.Repo, URL: f.RepoURL, Dir: home, Stage: "results", Error: err.Error()})
+				ignores = &ignoreFile{}
+			}
+			ignoreFiles[home] = ignores
+		}
+
+		// The annotations are written along with the secret, so they can't hide the locked rules
+		if ignores.covers(f) {
+			suppressed[ignoreFileName]++
+		} else if !orgSettings.locked(f.Rule) && annotated(f, home) {
+			suppressed[allowAnnotation]++
+		} else {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
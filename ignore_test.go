@@ -0,0 +1,102 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The files of the current directory don't apply to the repos that have no working copy
+func TestRepoFilesWithoutWorkingCopy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "git-all-secrets-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(ignoreFileName, []byte("**\n"), 0644)
+	ioutil.WriteFile(repoConfigName, []byte("disableRules: [AWS API Key]\n"), 0644)
+
+	ignores, err := loadIgnoreFile("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ignores.covers(finding{Rule: "AWS API Key", Path: "config.yml", Secret: "AKIA"}) {
+		t.Error("the " + ignoreFileName + " of the current directory was applied")
+	}
+
+	config, err := loadRepoConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.disabled("AWS API Key") {
+		t.Error("the " + repoConfigName + " of the current directory was applied")
+	}
+}
+
+// The repo can't hide the findings of the locked rules with paths or annotations, only
+// acknowledge one reported finding with its fingerprint
+func TestIgnoresOfLockedRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "git-all-secrets-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(repos string, settings *scanConfig) { reposDir, orgSettings = repos, settings }(reposDir, orgSettings)
+	reposDir = dir
+	orgSettings = &scanConfig{LockedRules: []string{"AWS API Key"}}
+
+	id := newRepoID("acme", repoKind, "api")
+	home := cloneDir(id)
+	os.MkdirAll(home, 0700)
+	acknowledged := finding{Host: id.Host, OrgOrUser: id.Owner, Kind: id.Kind, Repo: id.Name, Rule: "AWS API Key", Path: "test/keys.go", Secret: "AKIAACKNOWLEDGED"}
+	ioutil.WriteFile(filepath.Join(home, ignoreFileName), []byte("test/**\n"+acknowledged.fingerprint()+"\n"), 0644)
+	ioutil.WriteFile(filepath.Join(home, "main.go"), []byte("key := \"AKIAANNOTATED\" // gas:allow\ntoken := \"xoxb-annotated\" // gas:allow\n"), 0644)
+
+	tests := []struct {
+		finding finding
+		kept    bool
+	}{
+		{acknowledged, false},
+		{finding{Rule: "AWS API Key", Path: "test/other.go", Secret: "AKIAOTHER"}, true},
+		{finding{Rule: "Slack Token", Path: "test/other.go", Secret: "xoxb-other"}, false},
+		{finding{Rule: "AWS API Key", Path: "main.go", Secret: "AKIAANNOTATED"}, true},
+		{finding{Rule: "Slack Token", Path: "main.go", Secret: "xoxb-annotated"}, false},
+	}
+	for _, test := range tests {
+		f := test.finding
+		f.Host, f.OrgOrUser, f.Kind, f.Repo = id.Host, id.Owner, id.Kind, id.Name
+		kept := applyIgnores([]finding{f}, make(map[string]int))
+		if (len(kept) == 1) != test.kept {
+			t.Errorf("%s in %s kept = %v, want %v", f.Rule, f.Path, len(kept) == 1, test.kept)
+		}
+	}
+}
+
+func TestAnnotated(t *testing.T) {
+	tests := []struct {
+		diff      string
+		secret    string
+		annotated bool
+	}{
+		{"@@ -1 +1 @@\n+key = \"AKIA1\" # gas:allow\n", "AKIA1", true},
+		{"@@ -1,2 +1,2 @@\n key = \"AKIA1\" # gas:allow\n-other\n+other2\n", "AKIA1", true},
+		{"@@ -1 +0,0 @@\n-key = \"AKIA1\" # gas:allow\n", "AKIA1", false},
+		{"@@ -1 +1 @@\n-key = \"AKIA1\" # gas:allow\n+key = \"AKIA1\"\n", "AKIA1", false},
+		{"@@ -1 +1 @@\n+key = \"AKIA2\" # gas:allow\n+key = \"AKIA1\"\n", "AKIA1", false},
+		{"@@ -1 +1 @@\n+# gas:allow\n", "", false},
+	}
+	for _, test := range tests {
+		if annotated := annotated(finding{Diff: test.diff, Secret: test.secret}, ""); annotated != test.annotated {
+			t.Errorf("annotated(%q, %q) = %v, want %v", test.diff, test.secret, annotated, test.annotated)
+		}
+	}
+}
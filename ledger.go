@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// ledgerEntry is a repository that could not be cloned or scanned
+type ledgerEntry struct {
+	Host      string `json:"host,omitempty"`
+	OrgOrUser string `json:"orgOrUser"`
+	Kind      string `json:"kind,omitempty"`
+	Repo      string `json:"repo"`
+	URL       string `json:"url"`
+	Dir       string `json:"dir"`
+	Stage     string `json:"stage"`
+	Tool      string `json:"tool,omitempty"`
+	Error     string `json:"error"`
+	Attempts  int    `json:"attempts,omitempty"`
+}
+
+// failureLedger lists every repository that failed during the run along with why. It is
+// written next to the output file and read back by the retry-failed command.
+type failureLedger struct {
+	mutex sync.Mutex
+	// WorkDir has the clones and results of the run, which the retry-failed command reuses
+	WorkDir string `json:"workDir,omitempty"`
+	// Incomplete is set when the scan was interrupted, so not every repo was listed
+	Incomplete bool          `json:"incomplete,omitempty"`
+	Failures   []ledgerEntry `json:"failures"`
+}
+
+var failures = &failureLedger{}
+
+func (e ledgerEntry) id() repoID {
+	return repoID{Host: e.Host, Owner: e.OrgOrUser, Kind: e.Kind, Name: e.Repo}
+}
+
+func (l *failureLedger) record(entry ledgerEntry) {
+	// The repo is found from the directory it is cloned into when it is not provided
+	if entry.Repo == "" && entry.Dir != "" {
+		if id, ok := idFromDir(entry.Dir); ok {
+			entry.Host, entry.OrgOrUser, entry.Kind, entry.Repo = id.Host, id.Owner, id.Kind, id.Name
+		}
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.Failures = append(l.Failures, entry)
+}
+
+func (l *failureLedger) count() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return len(l.Failures)
+}
+
+// entries is a sorted copy of the failures, for the reports
+func (l *failureLedger) entries() []ledgerEntry {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	entries := append([]ledgerEntry(nil), l.Failures...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].id().less(entries[j].id())
+	})
+	return entries
+}
+
+func (l *failureLedger) write(file string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	sort.SliceStable(l.Failures, func(i, j int) bool {
+		return l.Failures[i].Dir < l.Failures[j].Dir
+	})
+	if l.Failures == nil {
+		l.Failures = []ledgerEntry{}
+	}
+	content, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, append(content, '\n'), 0644)
+}
+
+func loadLedger(file string) (*failureLedger, error) {
+	l := &failureLedger{}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return l, json.Unmarshal(content, l)
+}
+
+// recordListFailure records that the repos, gists, members or teams of an org or user could
+// not all be listed. The ones that were listed are still cloned and scanned.
+func recordListFailure(owner string, err error) {
+	Info("Listing failed for: " + owner + ". The repos that were listed are still scanned")
+	fmt.Fprintln(console, err)
+	failures.record(ledgerEntry{Host: githubHost(), OrgOrUser: owner, Stage: "list", Error: err.Error()})
+}
+
+// recoverFailure is deferred by the goroutines that clone or scan a repo, so that a panic only
+// fails that repo and the other ones are still cloned, scanned and reported
+func recoverFailure(entry ledgerEntry) {
+	if r := recover(); r != nil {
+		entry.Error = fmt.Sprint(r)
+		Info("Unexpected error with: " + entry.Dir + ". Please scan it manually.")
+		fmt.Fprintln(console, entry.Error)
+		failures.record(entry)
+	}
+}
+
+// ledgerFile is where the ledger of the run is written, next to the output file
+func ledgerFile() string {
+	return *outputFile + ".failures.json"
+}
+
+// retryfailed clones again the repos of the ledger that could not be cloned, then scans again
+// every repo of the ledger. Repos that still fail end up in the ledger of this run.
+func retryfailed(file string) error {
+	previous, err := loadLedger(file)
+	if err != nil {
+		return err
+	}
+	Info("Retrying the %d failures of %s\n", len(previous.Failures), file)
+
+	retried := make(map[repoID]bool)
+	p := newPipeline()
+	for _, entry := range previous.Failures {
+		// Listing failures have no repo to clone again
+		if entry.Dir == "" {
+			Info("The " + entry.Stage + " failure of " + entry.OrgOrUser + " can't be retried on its own. Please scan " + entry.OrgOrUser + " again")
+			failures.record(entry)
+			continue
+		}
+		// a repo can fail with several tools but only needs to be scanned again once
+		id := entry.id()
+		if retried[id] {
+			continue
+		}
+		retried[id] = true
+
+		job := repoJob{URL: entry.URL, ID: id}
+		if entry.Stage == "clone" || !fileExists(filepath.Join(cloneDir(id), ".git")) {
+			os.RemoveAll(cloneDir(id))
+			p.add(job)
+		} else {
+			p.addCloned(job)
+		}
+	}
+	p.wait()
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// retry-failed clones again the repos that failed to clone, scans again the ones that failed to
+// scan and keeps the listing failures, which can't be retried on their own
+func TestRetryFailed(t *testing.T) {
+	s, restore := newTestScan(t)
+	defer restore()
+
+	api, web := newRepoID("acme", repoKind, "api"), newRepoID("acme", repoKind, "web")
+	apiURL, webURL := s.source("api"), s.source("web")
+	if !gitclone(webURL, cloneDir(web)) {
+		t.Fatal("cloning web failed")
+	}
+	previous := &failureLedger{Failures: []ledgerEntry{
+		{Host: api.Host, OrgOrUser: "acme", Kind: repoKind, Repo: "api", URL: apiURL, Dir: cloneDir(api), Stage: "clone", Error: "timed out"},
+		{Host: web.Host, OrgOrUser: "acme", Kind: repoKind, Repo: "web", URL: webURL, Dir: cloneDir(web) + "/", Stage: "scan", Tool: "truffleHog", Error: "killed"},
+		{Host: web.Host, OrgOrUser: "acme", Kind: repoKind, Repo: "web", URL: webURL, Dir: cloneDir(web) + "/", Stage: "scan", Tool: "repo-supervisor", Error: "killed"},
+		{Host: api.Host, OrgOrUser: "jdoe", Stage: "list", Error: "rate limited"},
+	}}
+	ledgerPath := filepath.Join(s.dir, "output.txt.failures.json")
+	if err := previous.write(ledgerPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := retryfailed(ledgerPath); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(s.scanned(), ","); got != "api,web" {
+		t.Errorf("scanned %s, want api and web once each", got)
+	}
+	if count := collected.count(); count != 2 {
+		t.Errorf("%d findings were collected, want 2", count)
+	}
+	entries := failures.entries()
+	if len(entries) != 1 || entries[0].Stage != "list" || entries[0].OrgOrUser != "jdoe" {
+		t.Errorf("failures = %+v, want the listing failure of jdoe only", entries)
+	}
+
+	// The new ledger is read back the same
+	if err := failures.write(ledgerPath); err != nil {
+		t.Fatal(err)
+	}
+	written, err := loadLedger(ledgerPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(written.Failures) != 1 || written.Failures[0].Error != "rate limited" {
+		t.Errorf("the ledger has %+v", written.Failures)
+	}
+}
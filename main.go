@@ -6,15 +6,16 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
-	"io"
 	"io/ioutil"
-	"log"
+	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
-	"sync"
+	"time"
 
 	"golang.org/x/oauth2"
 
@@ -23,7 +24,7 @@ import (
 
 var (
 	org                  = flag.String("org", "", "Name of the Organization to scan. Example: secretorg123")
-	token                = flag.String("token", "", "Github Personal Access Token. This is required.")
+	token                = flag.String("token", "", "Github Personal Access Token, or comma separated tokens to spread the API calls over. This is required unless authenticating as a Github App.")
 	outputFile           = flag.String("output", "results.txt", "Output file to save the results.")
 	user                 = flag.String("user", "", "Name of the Github user to scan. Example: secretuser1")
 	repoURL              = flag.String("repoURL", "", "HTTPS URL of the Github repo to scan. Example: https://github.com/anshumantestorg/repo1.git")
@@ -34,11 +35,59 @@ var (
 	teamName             = flag.String("teamName", "", "Name of the Organization Team which has access to private repositories for scanning.")
 	scanPrivateReposOnly = flag.Bool("scanPrivateReposOnly", false, "Option to scan private repositories only. Default is false")
 	enterpriseURL        = flag.String("enterpriseURL", "", "Base URL of the Github Enterprise")
-	threads              = flag.Int("threads", 10, "Amount of parallel threads")
+	threads              = flag.Int("threads", 10, "Amount of parallel threads of each stage of the pipeline: cloning, scanning and cleaning up")
+	cloneThreads         = flag.Int("cloneThreads", 0, "Amount of parallel clones. Default is the threads flag")
+	scanThreads          = flag.Int("scanThreads", 0, "Amount of parallel scans. Default is the threads flag")
+	maxDisk              = flag.String("maxDisk", "", "Disk space the clones can take, for instance 500M or 20G. No clone is started while it is used up. Default is no limit")
+	keepClones           = flag.Bool("keepClones", true, "Option to keep the clones once they are scanned. Set it to false to delete each clone as soon as every tool scanned it")
 	thogEntropy          = flag.Bool("thogEntropy", false, "Option to include high entropy secrets when truffleHog is used")
 	mergeOutput          = flag.Bool("mergeOutput", false, "Merge the output files of all the tools used into one JSON file")
-	blacklist            = flag.String("blacklist", "", "Comma seperated values of Repos to Skip Scanning for")
-	executionQueue       chan bool
+	blacklist            = flag.String("blacklist", "", "Comma seperated values of exact Repo names to Skip Scanning for")
+	includeRepos         = flag.String("includeRepos", "", "Comma separated repo names, owner/name pairs, globs or /regexes/ to scan, or @file to read them from a file. Other repos are not scanned")
+	excludeRepos         = flag.String("excludeRepos", "", "Comma separated repo names, owner/name pairs, globs or /regexes/ not to scan, or @file to read them from a file")
+	format               = flag.String("format", "text", "Format of the output file. Options are text, json or html")
+	baselineFile         = flag.String("baseline", "", "Baseline file of accepted findings. Findings in the baseline are not reported. The baseline command writes the current findings into it")
+	acceptedBy           = flag.String("acceptedBy", os.Getenv("USER"), "Who accepted the findings added to the baseline by the baseline command")
+	acceptReason         = flag.String("acceptReason", "", "Why the findings added to the baseline by the baseline command were accepted")
+	excludePaths         = flag.String("excludePaths", "", "Comma separated globs of paths whose findings are not reported. ** matches any number of directories. Example: **/node_modules/**,vendor/,*.min.js")
+	includePaths         = flag.String("includePaths", "", "Comma separated globs of paths. If provided, only findings in these paths are reported")
+	archived             = flag.String("archived", "include", "Whether to include, exclude or only scan archived repos. Options are include, exclude or only")
+	skipDisabled         = flag.Bool("skipDisabled", true, "Option to skip disabled repos. Default is true")
+	visibility           = flag.String("visibility", "", "Comma separated visibilities of the repos to scan. Options are public, private and internal. Default is all")
+	languages            = flag.String("languages", "", "Comma separated primary languages of the repos to scan. Default is all")
+	topics               = flag.String("topics", "", "Comma separated topics. If provided, only repos with at least one of these topics are scanned")
+	minSize              = flag.Int("minSize", 0, "Minimum size of the repos to scan in KB, as reported by Github. Default is no limit")
+	maxSize              = flag.Int("maxSize", 0, "Maximum size of the repos to scan in KB, as reported by Github. Default is no limit")
+	pushedAfter          = flag.String("pushedAfter", "", "Only scan repos pushed after this date (2019-01-31) or this long ago (24h, 7d)")
+	linguistFiles        = flag.String("linguistFiles", "scan", "What to do with findings in files tagged linguist-vendored or linguist-generated in .gitattributes. Options are skip, downrank or scan")
+	cacheDir             = flag.String("cacheDir", "", "Directory where repos are kept as bare mirrors between runs and updated with git fetch instead of cloned again")
+	cloneStrategy        = flag.String("cloneStrategy", "full", "How much history to clone. Options are full, depth (see cloneDepth), since (see shallowSince) or blobless")
+	cloneDepth           = flag.Int("cloneDepth", 50, "Number of commits per branch to clone with the depth cloneStrategy")
+	shallowSince         = flag.String("shallowSince", "", "Date from which commits are cloned with the since cloneStrategy. Example: 2019-01-31")
+	cloneProtocol        = flag.String("cloneProtocol", "ssh", "Protocol used to clone private and enterprise repos. Options are ssh, which needs the SSH key, or https, which uses the token")
+	cloneTimeout         = flag.Duration("cloneTimeout", 0, "Timeout of each clone, for instance 30m. Default is no timeout")
+	cloneRetries         = flag.Int("cloneRetries", 3, "Number of times a clone is retried after a transient error")
+	cloneBackoff         = flag.Duration("cloneBackoff", 5*time.Second, "Delay before the first clone retry, doubled after every retry")
+	ledger               = flag.String("ledger", "", "Failure ledger read by the retry-failed command. Default is the output file name followed by .failures.json")
+	sshKey               = flag.String("sshKey", filepath.Join(homeDir(), ".ssh", "id_rsa"), "Path of the private SSH key used to clone over SSH")
+	sshAgent             = flag.Bool("sshAgent", false, "Option to use the keys of the ssh-agent at SSH_AUTH_SOCK instead of the sshKey file. Default is false")
+	sshPassphraseEnv     = flag.String("sshPassphraseEnv", "", "Environment variable holding the passphrase of the SSH key")
+	sshPassphraseFile    = flag.String("sshPassphraseFile", "", "File holding the passphrase of the SSH key")
+	knownHosts           = flag.String("knownHosts", filepath.Join(homeDir(), ".ssh", "known_hosts"), "known_hosts file the host keys of the SSH servers are verified against")
+	appID                = flag.Int64("appID", 0, "ID of the Github App to authenticate as instead of using a token")
+	appPrivateKey        = flag.String("appPrivateKey", "", "Path of the PEM private key of the Github App")
+	appInstallationID    = flag.Int64("appInstallationID", 0, "ID of the installation of the Github App to use. Default is the installation on the org or user being scanned")
+	resume               = flag.Bool("resume", false, "Option to continue the scan that wrote the checkpoint next to the output file, reusing its listings, clones and results. Default is false")
+	failOn               = flag.String("failOn", "low", "Lowest severity of the findings that make the exit code 1. Options are low, medium, high, critical or none")
+	orgConfig            = flag.String("orgConfig", "", "YAML file with the settings applied to every repo, including the rules repos are not allowed to disable")
+	configFile           = flag.String("config", "", "YAML file of flag values, for instance workDir: /data/work. The flags of the command line take precedence")
+	workDir              = flag.String("workDir", "", "Directory the repos are cloned into and the results are written to. Default is a new directory in the temporary directory of the system for every run")
+	resultsDirFlag       = flag.String("resultsDir", "", "Directory the results of the tools are written to. Default is the results directory in the workDir")
+	rulesFile            = flag.String("rulesFile", "", "Rules of truffleHog. Default is the rules.json next to the git-all-secrets binary, in the current directory or in /root/truffleHog")
+	gitPath              = flag.String("git", "git", "Path of the git binary, looked up in the PATH by default")
+	trufflehogPath       = flag.String("trufflehog", "trufflehog", "Path of the truffleHog binary, looked up in the PATH by default")
+	repoSupervisorPath   = flag.String("repoSupervisor", "", "Path of the runreposupervisor.sh script. Default is the one in the PATH, next to the git-all-secrets binary or in /root/repo-supervisor")
+	progressInterval     = flag.Duration("progress", time.Minute, "How often a summary of the progress is printed when the output is not a terminal, for instance 30s. On a terminal, the progress is refreshed below the output. Set it to 0 to hide the progress")
 )
 
 type truffleHogOutput struct {
@@ -58,49 +107,124 @@ type reposupervisorOutput struct {
 }
 
 type repositoryScan struct {
-	Repository string              `json:"repository"`
-	Results    map[string][]string `json:"stringsFound"`
+	Repository       string                `json:"repository"`
+	Host             string                `json:"host"`
+	OrgOrUser        string                `json:"orgOrUser"`
+	Kind             string                `json:"kind"`
+	Name             string                `json:"name"`
+	TruncatedHistory string                `json:"truncatedHistory,omitempty"`
+	Results          map[string][]string   `json:"stringsFound"`
+	Secrets          []fingerprintedSecret `json:"secrets"`
 }
 
-func enqueueJob(item func()) {
-	executionQueue <- true
-	go func() {
-		item()
-		<-executionQueue
-	}()
+// fingerprintedSecret is a secret of the JSON output along with the fingerprint that the
+// .gitallsecretsignore file and the baseline recognize it by
+type fingerprintedSecret struct {
+	Path        string `json:"path"`
+	Rule        string `json:"rule"`
+	Secret      string `json:"secret"`
+	Fingerprint string `json:"fingerprint"`
 }
 
 // Info Function to show colored text
 func Info(format string, args ...interface{}) {
-	fmt.Printf("\x1b[34;1m%s\x1b[0m\n", fmt.Sprintf(format, args...))
+	fmt.Fprintf(console, "\x1b[34;1m%s\x1b[0m\n", fmt.Sprintf(format, args...))
 }
 
-func check(e error) {
-	if e != nil {
-		panic(e)
-	} else if _, ok := e.(*github.RateLimitError); ok {
-		log.Println("hit rate limit")
-	} else if _, ok := e.(*github.AcceptedError); ok {
-		log.Println("scheduled on GitHub side")
+// Clone errors that are not worth retrying, anything else is considered transient
+var permanentCloneErrors = []string{
+	"not found",
+	"Authentication failed",
+	"Permission denied",
+	"could not read Username",
+	"already exists and is not an empty directory",
+}
+
+func transientCloneError(err error) bool {
+	for _, msg := range permanentCloneErrors {
+		if strings.Contains(err.Error(), msg) {
+			return false
+		}
 	}
+	return true
 }
 
-func gitclone(cloneURL string, repoName string, wg *sync.WaitGroup) {
-	defer wg.Done()
+func clonerepo(cloneURL string, repoName string) error {
+	ctx := runCtx
+	if *cloneTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *cloneTimeout)
+		defer cancel()
+	}
 
-	cmd := exec.Command("/usr/bin/git", "clone", cloneURL, repoName)
-	var out, stderr bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &stderr
-	err := cmd.Run()
-	if err != nil {
-		fmt.Println(fmt.Sprint(err) + ": " + stderr.String())
-		// panic(err)
+	var err error
+	if *cacheDir != "" {
+		err = mirrorclone(ctx, cloneURL, repoName)
+	} else {
+		args := append(append(append(gitConfigArgs(), "clone"), cloneStrategyArgs()...), cloneURL, repoName)
+		cmd := exec.Command(*gitPath, args...)
+		cmd.Env = gitEnv()
+		var out, stderr bytes.Buffer
+		cmd.Stdout = &out
+		cmd.Stderr = &stderr
+		err = runCommand(ctx, cmd)
+		if err != nil {
+			err = fmt.Errorf("%v: %s", err, stderr.String())
+		}
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("cloning timed out after %s", *cloneTimeout)
+	}
+	return err
+}
+
+// gitclone clones the repo, retrying transient errors with an exponential backoff, and tells
+// whether it was cloned. Repos that can't be cloned are recorded in the failure ledger.
+func gitclone(cloneURL string, repoName string) (cloned bool) {
+	defer recoverFailure(ledgerEntry{URL: cloneURL, Dir: repoName, Stage: "clone"})
+
+	// No new clones are started once the run is interrupted
+	if interrupted() {
+		failures.record(ledgerEntry{URL: cloneURL, Dir: repoName, Stage: "clone", Error: "interrupted before cloning"})
+		return false
+	}
+
+	if scanCheckpoint.finished("clone", repoName) && fileExists(repoName+"/.git") {
+		fmt.Fprintln(console, "Reusing the clone of "+cloneURL+" from the checkpoint")
+		return true
+	}
+	if *resume {
+		// The previous run may have died in the middle of this clone
+		os.RemoveAll(repoName)
+	}
+
+	backoff := *cloneBackoff
+	for attempt := 1; ; attempt++ {
+		err := clonerepo(cloneURL, repoName)
+		if err == nil {
+			scanCheckpoint.finish("clone", repoName)
+			return true
+		}
+
+		if attempt > *cloneRetries || !transientCloneError(err) || interrupted() {
+			fmt.Fprintln(console, "Cloning "+cloneURL+" failed: "+err.Error())
+			failures.record(ledgerEntry{URL: cloneURL, Dir: repoName, Stage: "clone", Error: strings.TrimSpace(err.Error()), Attempts: attempt})
+			return false
+		}
+
+		fmt.Fprintf(console, "Cloning %s failed, retrying in %s: %v\n", cloneURL, backoff, err)
+		os.RemoveAll(repoName)
+		select {
+		case <-time.After(backoff):
+		case <-runCtx.Done():
+		}
+		backoff *= 2
 	}
 }
 
 func gitRepoURL(path string) (string, error) {
-	out, err := exec.Command("/usr/bin/git", "-C", path, "config", "--get", "remote.origin.url").Output()
+	out, err := exec.Command(*gitPath, "-C", path, "config", "--get", "remote.origin.url").Output()
 	if err != nil {
 		return "", err
 	}
@@ -108,8 +232,9 @@ func gitRepoURL(path string) (string, error) {
 	return url, nil
 }
 
-// Moving cloning logic out of individual functions
-func executeclone(repo *github.Repository, directory string, wg *sync.WaitGroup) {
+// queueRepo queues the repo in the pipeline to be cloned and scanned. It is stored under the
+// login of its owner, or under the org or user it was listed for when Github doesn't give one.
+func queueRepo(p *pipeline, repo *github.Repository, orgoruser string) {
 	urlToClone := ""
 
 	switch *scanPrivateReposOnly {
@@ -125,130 +250,109 @@ func executeclone(repo *github.Repository, directory string, wg *sync.WaitGroup)
 		urlToClone = *repo.SSHURL
 	}
 
-	var orgclone sync.WaitGroup
+	if *cloneProtocol == "https" {
+		urlToClone = *repo.CloneURL
+	}
+
 	if !*cloneForks && *repo.Fork {
-		fmt.Println(*repo.Name + " is a fork and the cloneFork flag was set to false so moving on..")
+		fmt.Fprintln(console, *repo.Name+" is a fork and the cloneFork flag was set to false so moving on..")
 	} else {
-		// clone it
-		orgclone.Add(1)
-		fmt.Println(urlToClone)
-		func(orgclone *sync.WaitGroup, urlToClone string, directory string) {
-			enqueueJob(func() {
-				gitclone(urlToClone, directory, orgclone)
-			})
-		}(&orgclone, urlToClone, directory)
+		owner := repo.GetOwner().GetLogin()
+		if owner == "" {
+			owner = orgoruser
+		}
+		// Github reports the size in KB
+		p.add(repoJob{URL: urlToClone, ID: newRepoID(owner, repoKind, *repo.Name), Size: int64(repo.GetSize()) * 1024})
 	}
-
-	orgclone.Wait()
-	wg.Done()
 }
 
-func cloneorgrepos(ctx context.Context, client *github.Client, org string) error {
+func cloneorgrepos(ctx context.Context, client *github.Client, org string, p *pipeline) error {
 
 	Info("Cloning the repositories of the organization: " + org)
 	Info("If the token provided belongs to a user in this organization, this will also clone all public AND private repositories of this org, irrespecitve of the scanPrivateReposOnly flag being set..")
 
-	var orgRepos []*github.Repository
-	opt := &github.RepositoryListByOrgOptions{
-		ListOptions: github.ListOptions{PerPage: 10},
-	}
-
-	for {
-		repos, resp, err := client.Repositories.ListByOrg(ctx, org, opt)
-		check(err)
-		orgRepos = append(orgRepos, repos...) //adding to the repo array
-		if resp.NextPage == 0 {
-			break
-		}
-		opt.Page = resp.NextPage
-	}
-
-	var orgrepowg sync.WaitGroup
+	// The repos listed before an error are still cloned
+	orgRepos, err := listRepos(ctx, client, "orgs/"+org+"/repos", url.Values{})
 
 	//iterating through the repo array
-	for _, repo := range orgRepos {
-		if strings.Contains(*blacklist, *repo.Name) {
-			fmt.Println("Repo " + *repo.Name + " is in the repo blacklist, moving on..")
-		} else {
-			orgrepowg.Add(1)
-			go executeclone(repo, "/tmp/repos/org/"+org+"/"+*repo.Name, &orgrepowg)
-		}
+	for _, repo := range selectRepos(orgRepos) {
+		queueRepo(p, &repo.Repository, org)
 	}
 
-	orgrepowg.Wait()
-	fmt.Println("Done cloning org repos.")
+	fmt.Fprintln(console, "Done listing org repos.")
+	if err != nil {
+		return fmt.Errorf("listing the repos of %s: %v", org, err)
+	}
 	return nil
 }
 
-func cloneuserrepos(ctx context.Context, client *github.Client, user string) error {
+func cloneuserrepos(ctx context.Context, client *github.Client, user string, p *pipeline) error {
 	Info("Cloning " + user + "'s repositories")
 	Info("If the scanPrivateReposOnly flag is set, this will only scan the private repositories of this user. If that flag is not set, only public repositories are scanned. ")
 
-	var uname string
-	var userRepos []*github.Repository
-	var opt3 *github.RepositoryListOptions
+	var userRepos []*repository
+	var err error
 
-	if *scanPrivateReposOnly {
-		uname = ""
-		opt3 = &github.RepositoryListOptions{
-			Visibility:  "private",
-			ListOptions: github.ListOptions{PerPage: 10},
+	if *scanPrivateReposOnly && appTokens != nil {
+		// An installation token has no user, so the private repos are the ones the installation can access
+		var installationRepos []*repository
+		installationRepos, err = listInstallationRepos(ctx, client)
+		for _, repo := range installationRepos {
+			if repo.GetPrivate() && strings.EqualFold(repo.GetOwner().GetLogin(), user) {
+				userRepos = append(userRepos, repo)
+			}
 		}
+	} else if *scanPrivateReposOnly {
+		userRepos, err = listRepos(ctx, client, "user/repos", url.Values{"visibility": {"private"}})
 	} else {
-		uname = user
-		opt3 = &github.RepositoryListOptions{
-			ListOptions: github.ListOptions{PerPage: 10},
-		}
-	}
-
-	for {
-		uRepos, resp, err := client.Repositories.List(ctx, uname, opt3)
-		check(err)
-		userRepos = append(userRepos, uRepos...) //adding to the userRepos array
-		if resp.NextPage == 0 {
-			break
-		}
-		opt3.Page = resp.NextPage
+		userRepos, err = listRepos(ctx, client, "users/"+user+"/repos", url.Values{})
 	}
 
-	var userrepowg sync.WaitGroup
 	//iterating through the userRepos array
-	for _, userRepo := range userRepos {
-		userrepowg.Add(1)
-		go executeclone(userRepo, "/tmp/repos/users/"+user+"/"+*userRepo.Name, &userrepowg)
+	for _, userRepo := range selectRepos(userRepos) {
+		queueRepo(p, &userRepo.Repository, user)
 	}
 
-	userrepowg.Wait()
-	fmt.Println("Done cloning user repos.")
+	fmt.Fprintln(console, "Done listing user repos.")
+	if err != nil {
+		return fmt.Errorf("listing the repos of %s: %v", user, err)
+	}
 	return nil
 }
 
-func cloneusergists(ctx context.Context, client *github.Client, user string) error {
+func cloneusergists(ctx context.Context, client *github.Client, user string, p *pipeline) error {
 	Info("Cloning " + user + "'s gists")
 	Info("Irrespective of the scanPrivateReposOnly flag being set or not, this will scan all public AND secret gists of a user whose token is provided")
 
 	var gisturl string
 
 	var userGists []*github.Gist
+	var listErr error
 	opt4 := &github.GistListOptions{
 		ListOptions: github.ListOptions{PerPage: 10},
 	}
-	for {
+	listed := scanCheckpoint.listing("users/"+user+"/gists", &userGists)
+	for !listed {
 		uGists, resp, err := client.Gists.List(ctx, user, opt4)
-		check(err)
+		if err != nil {
+			listErr = fmt.Errorf("listing the gists of %s: %v", user, err)
+			break
+		}
 		userGists = append(userGists, uGists...)
 		if resp.NextPage == 0 {
+			scanCheckpoint.saveListing("users/"+user+"/gists", userGists)
 			break
 		}
 		opt4.Page = resp.NextPage
 	}
 
-	var usergistclone sync.WaitGroup
 	//iterating through the userGists array
 	for _, userGist := range userGists {
-		usergistclone.Add(1)
+		if skipRepo(user, *userGist.ID) {
+			continue
+		}
 
-		if *enterpriseURL != "" {
+		if *enterpriseURL != "" && *cloneProtocol != "https" {
 			d := strings.Split(*userGist.GitPullURL, "/")[2]
 			f := strings.Split(*userGist.GitPullURL, "/")[4]
 			gisturl = "git@" + d + ":gist/" + f
@@ -256,18 +360,53 @@ func cloneusergists(ctx context.Context, client *github.Client, user string) err
 			gisturl = *userGist.GitPullURL
 		}
 
-		fmt.Println(gisturl)
-
 		//cloning the individual user gists
-		func(gisturl string, userGist *github.Gist, user string, usergistclone *sync.WaitGroup) {
-			enqueueJob(func() {
-				gitclone(gisturl, "/tmp/repos/users/"+user+"/"+*userGist.ID, usergistclone)
-			})
-		}(gisturl, userGist, user, &usergistclone)
+		p.add(repoJob{URL: gisturl, ID: newRepoID(user, gistKind, *userGist.ID)})
 	}
 
-	usergistclone.Wait()
-	return nil
+	return listErr
+}
+
+// repository adds the fields of the API that this version of go-github doesn't know about
+type repository struct {
+	github.Repository
+	Disabled   *bool   `json:"disabled,omitempty"`
+	Visibility *string `json:"visibility,omitempty"`
+}
+
+// listRepos lists all the pages of a repository listing endpoint such as orgs/<org>/repos.
+// When a page fails, the repos of the previous pages are returned along with the error.
+func listRepos(ctx context.Context, client *github.Client, u string, params url.Values) ([]*repository, error) {
+	var allRepos []*repository
+	params.Set("per_page", "10")
+
+	key := u + "?" + params.Encode()
+	if scanCheckpoint.listing(key, &allRepos) {
+		return allRepos, nil
+	}
+
+	for {
+		req, err := client.NewRequest("GET", u+"?"+params.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		// topics and the internal visibility are still in preview on older Github Enterprise versions
+		req.Header.Set("Accept", "application/vnd.github.mercy-preview+json, application/vnd.github.nebula-preview+json")
+
+		var repos []*repository
+		resp, err := client.Do(ctx, req, &repos)
+		if err != nil {
+			return allRepos, err
+		}
+		allRepos = append(allRepos, repos...)
+		if resp.NextPage == 0 {
+			break
+		}
+		params.Set("page", strconv.Itoa(resp.NextPage))
+	}
+
+	scanCheckpoint.saveListing(key, allRepos)
+	return allRepos, nil
 }
 
 func listallusers(ctx context.Context, client *github.Client, org string) ([]*github.User, error) {
@@ -276,10 +415,15 @@ func listallusers(ctx context.Context, client *github.Client, org string) ([]*gi
 	opt2 := &github.ListMembersOptions{
 		ListOptions: github.ListOptions{PerPage: 10},
 	}
+	if scanCheckpoint.listing("orgs/"+org+"/members", &allUsers) {
+		return allUsers, nil
+	}
 
 	for {
 		users, resp, err := client.Organizations.ListMembers(ctx, org, opt2)
-		check(err)
+		if err != nil {
+			return allUsers, fmt.Errorf("listing the members of %s: %v", org, err)
+		}
 		allUsers = append(allUsers, users...) //adding to the allUsers array
 		if resp.NextPage == 0 {
 			break
@@ -287,102 +431,142 @@ func listallusers(ctx context.Context, client *github.Client, org string) ([]*gi
 		opt2.Page = resp.NextPage
 	}
 
+	scanCheckpoint.saveListing("orgs/"+org+"/members", allUsers)
 	return allUsers, nil
 }
 
-func runTrufflehog(filepath string, reponame string, orgoruser string) error {
-	outputDir := "/tmp/results/" + orgoruser + "/" + reponame
+func runTrufflehog(filepath string, id repoID) error {
+	outputDir := resultDir(id)
 	os.MkdirAll(outputDir, 0700)
-	outputFile1 := outputDir + "/" + "truffleHog"
+	outputFile1 := resultPath(id, "truffleHog")
 
 	// open the out file for writing
-	outfile, fileErr := os.OpenFile(outputFile1, os.O_CREATE|os.O_RDWR, 0644)
-	check(fileErr)
+	outfile, fileErr := os.OpenFile(outputFile1, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if fileErr != nil {
+		return fileErr
+	}
 	defer outfile.Close()
 
-	params := []string{filepath, "--rules=/root/truffleHog/rules.json", "--regex"}
-	if *mergeOutput {
-		params = append(params, "--json")
+	// The repo can add, disable rules or set the entropy option in its .git-all-secrets.yml
+	config, err := loadRepoConfig(filepath)
+	if err != nil {
+		Info("Ignoring the invalid " + repoConfigName + " of: " + id.String())
+		fmt.Fprintln(console, err)
+	}
+	rules, err := config.thogRules(outputDir)
+	if err != nil {
+		return err
+	}
+
+	// The JSON output is always used since all the output formats are built from the parsed findings
+	params := []string{filepath, "--rules=" + rules, "--regex", "--json"}
+	if *cloneStrategy != "full" {
+		// Scan the partial clone as is rather than letting truffleHog clone it again
+		params = append(params, "--repo_path="+filepath)
 	}
 	var cmd1 *exec.Cmd
 
-	if *thogEntropy {
+	if config.entropy() {
 		params = append(params, "--entropy=True")
 	} else {
 		params = append(params, "--entropy=False")
 	}
-	cmd1 = exec.Command("trufflehog", params...)
+	cmd1 = exec.Command(*trufflehogPath, params...)
+	// truffleHog fetches the repo and the blobless clones fetch blobs as they are read
+	cmd1.Env = gitEnv()
 
 	// direct stdout to the outfile
 	cmd1.Stdout = outfile
 
-	err1 := cmd1.Run()
+	err1 := runCommand(runCtx, cmd1)
 	// truffleHog returns an exit code 1 if it finds anything
 	if err1 != nil && err1.Error() != "exit status 1" {
-		Info("truffleHog Scanning failed for: " + orgoruser + "_" + reponame + ". Please scan it manually.")
-		fmt.Println(err1)
+		return err1
 	} else {
-		fmt.Println("Finished truffleHog Scanning for: " + orgoruser + "_" + reponame)
+		fmt.Fprintln(console, "Finished truffleHog Scanning for: "+id.String())
 	}
 
 	return nil
 }
 
-func runReposupervisor(filepath string, reponame string, orgoruser string) error {
-	outputDir := "/tmp/results/" + orgoruser + "/" + reponame
-	os.MkdirAll(outputDir, 0700)
-	outputFile3 := outputDir + "/" + "repo-supervisor"
+func runReposupervisor(filepath string, id repoID) error {
+	os.MkdirAll(resultDir(id), 0700)
+	outputFile3 := resultPath(id, "repo-supervisor")
 
-	cmd3 := exec.Command("/root/repo-supervisor/runreposupervisor.sh", filepath, outputFile3)
+	cmd3 := exec.Command(*repoSupervisorPath, filepath, outputFile3)
 	var out3 bytes.Buffer
 	cmd3.Stdout = &out3
-	err3 := cmd3.Run()
+	err3 := runCommand(runCtx, cmd3)
 	if err3 != nil {
-		Info("Repo Supervisor Scanning failed for: " + orgoruser + "_" + reponame + ". Please scan it manually.")
-		fmt.Println(err3)
+		return err3
 	} else {
-		fmt.Println("Finished Repo Supervisor Scanning for: " + orgoruser + "_" + reponame)
+		fmt.Fprintln(console, "Finished Repo Supervisor Scanning for: "+id.String())
 	}
 	return nil
 }
 
-func runGitTools(tool string, filepath string, wg *sync.WaitGroup, reponame string, orgoruser string) {
-	defer wg.Done()
+// scanFailed records that a tool could not scan a repo, the other tools and repos are still scanned
+func scanFailed(toolname string, filepath string, id repoID, err error) {
+	Info(toolname + " Scanning failed for: " + id.String() + ". Please scan it manually.")
+	fmt.Fprintln(console, err)
+	url, _ := gitRepoURL(filepath)
+	failures.record(ledgerEntry{Host: id.Host, OrgOrUser: id.Owner, Kind: id.Kind, Repo: id.Name, URL: url, Dir: filepath, Stage: "scan", Tool: toolname, Error: err.Error()})
+}
 
-	switch tool {
-	case "all":
-		err := runTrufflehog(filepath, reponame, orgoruser)
-		check(err)
-		err = runReposupervisor(filepath, reponame, orgoruser)
-		check(err)
+func runGitTools(tool string, filepath string, id repoID) {
+	defer recoverFailure(ledgerEntry{Host: id.Host, OrgOrUser: id.Owner, Kind: id.Kind, Repo: id.Name, Dir: filepath, Stage: "scan"})
 
-	case "thog":
-		err := runTrufflehog(filepath, reponame, orgoruser)
-		check(err)
+	// No new scans are started once the run is interrupted
+	if interrupted() {
+		failures.record(ledgerEntry{Host: id.Host, OrgOrUser: id.Owner, Kind: id.Kind, Repo: id.Name, Dir: filepath, Stage: "scan", Error: "interrupted before scanning"})
+		return
+	}
 
-	case "repo-supervisor":
-		err := runReposupervisor(filepath, reponame, orgoruser)
-		check(err)
+	if tool == "all" || tool == "thog" {
+		if scanCheckpoint.finished("scan:truffleHog", filepath) && fileExists(resultPath(id, "truffleHog")) {
+			fmt.Fprintln(console, "Reusing the truffleHog results of "+id.String()+" from the checkpoint")
+		} else if err := runTrufflehog(filepath, id); err != nil {
+			scanFailed("truffleHog", filepath, id, err)
+		} else {
+			scanCheckpoint.finish("scan:truffleHog", filepath)
+		}
+	}
+	if tool == "all" || tool == "repo-supervisor" {
+		if scanCheckpoint.finished("scan:repo-supervisor", filepath) && fileExists(resultPath(id, "repo-supervisor")) {
+			fmt.Fprintln(console, "Reusing the repo-supervisor results of "+id.String()+" from the checkpoint")
+		} else if err := runReposupervisor(filepath, id); err != nil {
+			scanFailed("repo-supervisor", filepath, id, err)
+		} else {
+			scanCheckpoint.finish("scan:repo-supervisor", filepath)
+		}
 	}
 }
 
-func scanforeachuser(user string, wg *sync.WaitGroup) {
-	defer wg.Done()
-
-	var wguserrepogist sync.WaitGroup
-	gituserrepos, _ := ioutil.ReadDir("/tmp/repos/users/" + user)
-	for _, f := range gituserrepos {
-		wguserrepogist.Add(1)
-		func(user string, wg *sync.WaitGroup, wguserrepogist *sync.WaitGroup, f os.FileInfo) {
-			enqueueJob(func() {
-				runGitTools(*toolName, "/tmp/repos/users/"+user+"/"+f.Name()+"/", wguserrepogist, f.Name(), user)
-			})
-		}(user, wg, &wguserrepogist, f)
+func writeTextFinding(of *os.File, f finding, printDiff bool) error {
+	var lines []string
+	switch f.Tool {
+	case "truffleHog":
+		lines = []string{
+			"Reason: " + f.Rule,
+			"Date: " + f.Date,
+			"Hash: " + f.Hash,
+			"Filepath: " + f.Path,
+			"Branch: " + f.Branch,
+			"Commit: " + f.Commit,
+		}
+		if printDiff {
+			lines = append(lines, f.Diff)
+		}
+	default:
+		lines = []string{"Filepath: " + f.Path}
 	}
-	wguserrepogist.Wait()
+	lines = append(lines, "String found: "+f.Secret, "Fingerprint: "+f.Fingerprint)
+
+	_, err := of.WriteString(strings.Join(lines, "\n") + "\n\n")
+	return err
 }
 
-func toolsOutput(toolname string, of *os.File) error {
+func toolsOutput(toolname string, findings []finding, of *os.File) error {
 
 	linedelimiter := "----------------------------------------------------------------------------" +
 		"----------------------------------------------------------------------------" +
@@ -390,186 +574,152 @@ func toolsOutput(toolname string, of *os.File) error {
 		"----------------------------------------------------------------------------"
 
 	_, err := of.WriteString("Tool: " + toolname + "\n")
-	check(err)
-
-	users, _ := ioutil.ReadDir("/tmp/results/")
-	for _, user := range users {
-		repos, _ := ioutil.ReadDir("/tmp/results/" + user.Name() + "/")
-		for _, repo := range repos {
-			file, err := os.Open("/tmp/results/" + user.Name() + "/" + repo.Name() + "/" + toolname)
-			check(err)
-
-			fi, err := file.Stat()
-			check(err)
-
-			if fi.Size() == 0 {
-				continue
-			} else if fi.Size() > 0 {
-				orgoruserstr := user.Name()
-				rnamestr := repo.Name()
+	if err != nil {
+		return err
+	}
 
-				_, err1 := of.WriteString("OrgorUser: " + orgoruserstr + " RepoName: " + rnamestr + "\n")
-				check(err1)
+	started := false
+	var previous finding
+	for _, f := range findings {
+		if f.Tool != toolname {
+			continue
+		}
 
-				if _, err2 := io.Copy(of, file); err2 != nil {
-					return err2
+		newRepo := !started || previous.id() != f.id()
+		if newRepo {
+			if started {
+				if _, err := of.WriteString(linedelimiter + "\n"); err != nil {
+					return err
 				}
-
-				_, err3 := of.WriteString(linedelimiter + "\n")
-				check(err3)
-
-				of.Sync()
-
 			}
-			defer file.Close()
+			if _, err := of.WriteString("OrgorUser: " + f.OrgOrUser + " RepoName: " + f.Repo + " Kind: " + f.Kind + " Host: " + f.Host + "\n"); err != nil {
+				return err
+			}
+			if f.TruncatedHistory != "" {
+				if _, err := of.WriteString("History truncated: " + f.TruncatedHistory + "\n"); err != nil {
+					return err
+				}
+			}
+		}
 
+		// truffleHog reports all the strings of a commit diff together, so only print that diff once
+		printDiff := newRepo || previous.Hash != f.Hash || previous.Path != f.Path || previous.Rule != f.Rule
+		if err := writeTextFinding(of, f, printDiff); err != nil {
+			return err
 		}
+		previous = f
+		started = true
 	}
-	return nil
-}
-
-func singletoolOutput(toolname string, of *os.File) error {
-
-	users, _ := ioutil.ReadDir("/tmp/results/")
-	for _, user := range users {
-		repos, _ := ioutil.ReadDir("/tmp/results/" + user.Name() + "/")
-		for _, repo := range repos {
-			file, err := os.Open("/tmp/results/" + user.Name() + "/" + repo.Name() + "/" + toolname)
-			check(err)
-
-			fi, err := file.Stat()
-			check(err)
-
-			if fi.Size() == 0 {
-				continue
-			} else if fi.Size() > 0 {
-
-				if _, err2 := io.Copy(of, file); err2 != nil {
-					return err2
-				}
-				of.Sync()
-			}
-			defer file.Close()
+	if started {
+		if _, err := of.WriteString(linedelimiter + "\n"); err != nil {
+			return err
 		}
 	}
-	return nil
+
+	return of.Sync()
 }
 
-func combineOutput(toolname string, outputfile string) error {
-	// Read all files in /tmp/results/<tool-name>/ directories for all the tools
-	// open a new file and save it in the output directory - outputFile
-	// for each results file, write user/org and reponame, copy results from the file in the outputFile, end with some delimiter
+func combineOutput(toolname string, findings []finding, failed []ledgerEntry, incomplete bool, outputfile string) error {
+	// Write the findings of all the tools into the outputFile
+	// for each tool and each repository, write user/org and reponame, the findings and end with some delimiter
 
 	of, err := os.Create(outputfile)
-	check(err)
-
-	switch toolname {
-	case "all":
-		tools := []string{"truffleHog", "repo-supervisor"}
+	if err != nil {
+		return err
+	}
+	defer of.Close()
 
-		for _, tool := range tools {
-			err = toolsOutput(tool, of)
-			check(err)
+	if incomplete {
+		if _, err := of.WriteString("INCOMPLETE: the scan was interrupted, the repos that were not cloned or scanned are listed in the failures at the end\n\n"); err != nil {
+			return err
 		}
-	case "truffleHog":
-		err = singletoolOutput("truffleHog", of)
-		check(err)
-	case "repo-supervisor":
-		err = singletoolOutput("repo-supervisor", of)
-		check(err)
 	}
 
-	defer func() {
-		cerr := of.Close()
-		if err == nil {
-			err = cerr
+	for _, tool := range resultFiles(toolname) {
+		err = toolsOutput(tool, findings, of)
+		if err != nil {
+			return err
 		}
-	}()
+	}
 
-	return nil
+	return failuresOutput(failed, of)
 }
 
-func mergeOutputJSON(outputfile string) {
-	var results []repositoryScan
-	var basePaths []string
+// failuresOutput lists the repos whose secrets are missing from the output because they could not be scanned
+func failuresOutput(failed []ledgerEntry, of *os.File) error {
+	if len(failed) == 0 {
+		return nil
+	}
 
-	if *repoURL != "" || *gistURL != "" {
-		basePaths = []string{"/tmp/repos"}
-	} else {
-		basePaths = []string{"/tmp/repos/org", "/tmp/repos/users", "/tmp/repos/team"}
-	}
-
-	for _, basePath := range basePaths {
-		users, _ := ioutil.ReadDir(basePath)
-		for _, user := range users {
-			repos, _ := ioutil.ReadDir("/tmp/results/" + user.Name() + "/")
-			for _, repo := range repos {
-				repoPath := basePath + "/" + user.Name() + "/" + repo.Name() + "/"
-				repoResultsPath := "/tmp/results/" + user.Name() + "/" + repo.Name() + "/"
-				reposupvPath := repoResultsPath + "repo-supervisor"
-				thogPath := repoResultsPath + "truffleHog"
-				reposupvExists := fileExists(reposupvPath)
-				thogExists := fileExists(thogPath)
-				repoURL, _ := gitRepoURL(repoPath)
-
-				var mergedOut map[string][]string
-				if reposupvExists && thogExists {
-					reposupvOut, _ := loadReposupvOut(reposupvPath, repoPath)
-					thogOut, _ := loadThogOutput(thogPath)
-					mergedOut = mergeOutputs(reposupvOut, thogOut)
-				} else if reposupvExists {
-					mergedOut, _ = loadReposupvOut(reposupvPath, repoPath)
-				} else if thogExists {
-					mergedOut, _ = loadThogOutput(thogPath)
-				}
-				if len(mergedOut) > 0 {
-					results = append(results, repositoryScan{Repository: repoURL, Results: mergedOut})
-				}
-			}
+	lines := []string{"Failures: " + strconv.Itoa(len(failed))}
+	for _, entry := range failed {
+		line := "OrgorUser: " + entry.OrgOrUser
+		if entry.Repo != "" {
+			line += " RepoName: " + entry.Repo
+		}
+		if entry.Kind != "" {
+			line += " Kind: " + entry.Kind
 		}
+		if entry.Host != "" {
+			line += " Host: " + entry.Host
+		}
+		line += " Stage: " + entry.Stage
+		if entry.Tool != "" {
+			line += " Tool: " + entry.Tool
+		}
+		lines = append(lines, line, "Error: "+strings.TrimSpace(entry.Error), "")
 	}
-	marshalledResults, err := json.Marshal(results)
-	check(err)
-	err = ioutil.WriteFile(outputfile, marshalledResults, 0644)
-	check(err)
+
+	if _, err := of.WriteString(strings.Join(lines, "\n")); err != nil {
+		return err
+	}
+	return of.Sync()
 }
 
-func appendIfMissing(slice []string, i string) []string {
-	for _, ele := range slice {
-		if ele == i {
-			return slice
+// mergeOutputJSON writes the JSON array of the repos and their secrets. Whether the scan was
+// interrupted and which repos could not be scanned are in the failure ledger and the exit code,
+// so that the array keeps the shape its consumers expect.
+func mergeOutputJSON(findings []finding, outputfile string) error {
+	results := []repositoryScan{}
+	index := make(map[repoID]int)
+	listed := make(map[string]bool)
+
+	for _, f := range findings {
+		i, ok := index[f.id()]
+		if !ok {
+			i = len(results)
+			index[f.id()] = i
+			results = append(results, repositoryScan{
+				Repository:       f.RepoURL,
+				Host:             f.Host,
+				OrgOrUser:        f.OrgOrUser,
+				Kind:             f.Kind,
+				Name:             f.Repo,
+				TruncatedHistory: f.TruncatedHistory,
+				Results:          make(map[string][]string),
+			})
+		}
+		results[i].Results[f.Path] = appendIfMissing(results[i].Results[f.Path], f.Secret)
+		if !listed[f.Fingerprint] {
+			listed[f.Fingerprint] = true
+			results[i].Secrets = append(results[i].Secrets, fingerprintedSecret{Path: f.Path, Rule: f.Rule, Secret: f.Secret, Fingerprint: f.Fingerprint})
 		}
 	}
-	return append(slice, i)
-}
 
-func loadThogOutput(outfile string) (map[string][]string, error) {
-	results := make(map[string][]string)
-	output, err := ioutil.ReadFile(outfile)
+	marshalledResults, err := json.Marshal(results)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	return ioutil.WriteFile(outputfile, marshalledResults, 0644)
+}
 
-	// There was an issue concerning truffleHog's output not being valid JSON
-	// https://github.com/dxa4481/truffleHog/issues/95
-	// but apparently it was closed without a fix.
-	entries := strings.Split(string(output), "\n")
-	for _, entry := range entries[:len(entries)-1] {
-		var issue truffleHogOutput
-		err := json.Unmarshal([]byte(entry), &issue)
-		if err != nil {
-			return nil, err
-		}
-		if _, found := results[issue.Path]; found {
-			for _, str := range issue.StringsFound {
-				results[issue.Path] = appendIfMissing(results[issue.Path], str)
-			}
-		} else {
-			results[issue.Path] = issue.StringsFound
+func appendIfMissing(slice []string, i string) []string {
+	for _, ele := range slice {
+		if ele == i {
+			return slice
 		}
-
 	}
-	return results, nil
+	return append(slice, i)
 }
 
 func loadReposupvOut(outfile string, home string) (map[string][]string, error) {
@@ -591,42 +741,6 @@ func loadReposupvOut(outfile string, home string) (map[string][]string, error) {
 	return results, nil
 }
 
-func mergeOutputs(outputA map[string][]string, outputB map[string][]string) map[string][]string {
-	for path, stringsFound := range outputA {
-		if _, included := outputB[path]; included {
-			outputB[path] = append(outputB[path], stringsFound...)
-		} else {
-			outputB[path] = stringsFound
-		}
-	}
-
-	return outputB
-}
-
-// Moving directory scanning logic out of individual functions
-func scanDir(dir string, org string) error {
-	var wg sync.WaitGroup
-
-	allRepos, _ := ioutil.ReadDir(dir)
-	for _, f := range allRepos {
-		wg.Add(1)
-		func(f os.FileInfo, wg *sync.WaitGroup, org string) {
-			enqueueJob(func() {
-				runGitTools(*toolName, dir+f.Name()+"/", wg, f.Name(), org)
-			})
-		}(f, &wg, org)
-
-	}
-	wg.Wait()
-	return nil
-}
-
-func scanorgrepos(org string) error {
-	err := scanDir("/tmp/repos/org/"+org+"/", org)
-	check(err)
-	return nil
-}
-
 func stringInSlice(a string, list []*github.Repository) (bool, error) {
 	for _, b := range list {
 		if *b.SSHURL == a || *b.CloneURL == a {
@@ -637,41 +751,74 @@ func stringInSlice(a string, list []*github.Repository) (bool, error) {
 }
 
 func checkifsshkeyexists() error {
-	fmt.Println("Checking to see if the SSH key exists or not..")
+	if *cloneProtocol == "https" {
+		// The token is used to clone instead
+		return nil
+	}
 
-	fi, err := os.Stat("/root/.ssh/id_rsa")
+	if *sshAgent {
+		if os.Getenv("SSH_AUTH_SOCK") == "" {
+			fmt.Fprintln(console, "SSH_AUTH_SOCK is not set so the ssh-agent can't be used. Please mount the agent socket and set it")
+			os.Exit(exitFatal)
+		}
+		return nil
+	}
+
+	fmt.Fprintln(console, "Checking to see if the SSH key exists or not..")
+
+	fi, err := os.Stat(*sshKey)
 	if err == nil && fi.Size() > 0 {
-		fmt.Println("SSH key exists and file size > 0 so continuing..")
+		fmt.Fprintln(console, "SSH key exists and file size > 0 so continuing..")
 	}
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(2)
+		fmt.Fprintln(console, err)
+		os.Exit(exitFatal)
+	}
+
+	if _, err := os.Stat(*knownHosts); err != nil {
+		fmt.Fprintln(console, "The known_hosts file is needed to verify the host keys of the SSH servers:", err)
+		os.Exit(exitFatal)
 	}
 	return nil
 }
 
-func checkflags(token string, org string, user string, repoURL string, gistURL string, teamName string, scanPrivateReposOnly bool, orgOnly bool, toolName string, enterpriseURL string, thogEntropy bool) error {
-	if token == "" {
-		fmt.Println("Need a Github personal access token. Please provide that using the -token flag")
-		os.Exit(2)
+func checkflags(token string, org string, user string, repoURL string, gistURL string, teamName string, scanPrivateReposOnly bool, orgOnly bool, toolName string, enterpriseURL string, thogEntropy bool, format string) error {
+	if token == "" && *appID == 0 {
+		fmt.Fprintln(console, "Need a Github personal access token. Please provide that using the -token flag, or authenticate as a Github App with the -appID and -appPrivateKey flags")
+		os.Exit(exitFatal)
+	} else if *appID != 0 && *appPrivateKey == "" {
+		fmt.Fprintln(console, "Need the private key of the Github App. Please provide that using the -appPrivateKey flag")
+		os.Exit(exitFatal)
 	} else if org == "" && user == "" && repoURL == "" && gistURL == "" {
-		fmt.Println("org, user, repoURL and gistURL can't all be empty. Please provide just one of these values")
-		os.Exit(2)
+		fmt.Fprintln(console, "org, user, repoURL and gistURL can't all be empty. Please provide just one of these values")
+		os.Exit(exitFatal)
 	} else if org != "" && (user != "" || repoURL != "" || gistURL != "") {
-		fmt.Println("Can't have org along with any of user, repoURL or gistURL. Please provide just one of these values")
-		os.Exit(2)
+		fmt.Fprintln(console, "Can't have org along with any of user, repoURL or gistURL. Please provide just one of these values")
+		os.Exit(exitFatal)
 	} else if user != "" && (org != "" || repoURL != "" || gistURL != "") {
-		fmt.Println("Can't have user along with any of org, repoURL or gistURL. Please provide just one of these values")
-		os.Exit(2)
+		fmt.Fprintln(console, "Can't have user along with any of org, repoURL or gistURL. Please provide just one of these values")
+		os.Exit(exitFatal)
 	} else if repoURL != "" && (org != "" || user != "" || gistURL != "") {
-		fmt.Println("Can't have repoURL along with any of org, user or gistURL. Please provide just one of these values")
-		os.Exit(2)
+		fmt.Fprintln(console, "Can't have repoURL along with any of org, user or gistURL. Please provide just one of these values")
+		os.Exit(exitFatal)
 	} else if gistURL != "" && (org != "" || repoURL != "" || user != "") {
-		fmt.Println("Can't have gistURL along with any of org, user or repoURL. Please provide just one of these values")
-		os.Exit(2)
+		fmt.Fprintln(console, "Can't have gistURL along with any of org, user or repoURL. Please provide just one of these values")
+		os.Exit(exitFatal)
 	} else if thogEntropy && !(toolName == "all" || toolName == "thog") {
-		fmt.Println("thogEntropy flag should be used only when thog is being run. So, either leave the toolName blank or the toolName should be thog")
-		os.Exit(2)
+		fmt.Fprintln(console, "thogEntropy flag should be used only when thog is being run. So, either leave the toolName blank or the toolName should be thog")
+		os.Exit(exitFatal)
+	} else if !(format == "text" || format == "json" || format == "html") {
+		fmt.Fprintln(console, "Please enter either text, json or html as the format. Default is text.")
+		os.Exit(exitFatal)
+	} else if !(*cloneProtocol == "ssh" || *cloneProtocol == "https") {
+		fmt.Fprintln(console, "Please enter either ssh or https as the cloneProtocol. Default is ssh.")
+		os.Exit(exitFatal)
+	} else if msg := checkCloneStrategy(*cloneStrategy, *cloneDepth, *shallowSince); msg != "" {
+		fmt.Fprintln(console, msg)
+		os.Exit(exitFatal)
+	} else if !(*linguistFiles == "skip" || *linguistFiles == "downrank" || *linguistFiles == "scan") {
+		fmt.Fprintln(console, "Please enter either skip, downrank or scan for linguistFiles. Default is scan.")
+		os.Exit(exitFatal)
 	} else if enterpriseURL == "" && (repoURL != "" || gistURL != "") {
 		var ed, url string
 
@@ -682,39 +829,52 @@ func checkflags(token string, org string, user string, repoURL string, gistURL s
 		}
 
 		if strings.Split(strings.Split(url, ":")[0], "@")[0] == "git" {
-			fmt.Println("SSH URL")
+			fmt.Fprintln(console, "SSH URL")
 			ed = strings.Split(strings.Split(url, ":")[0], "@")[1]
 		} else if strings.Split(url, "/")[0] == "https:" {
-			fmt.Println("HTTPS URL")
+			fmt.Fprintln(console, "HTTPS URL")
 			ed = strings.Split(url, "/")[2]
 		}
 
 		matched, err := regexp.MatchString("github.com", ed)
-		check(err)
+		if err != nil {
+			return err
+		}
 
 		if !matched {
-			fmt.Println("By the domain provided in the repoURL/gistURL, it looks like you are trying to scan a Github Enterprise repo/gist. Therefore, you need to provide the enterpriseURL flag as well")
-			os.Exit(2)
+			fmt.Fprintln(console, "By the domain provided in the repoURL/gistURL, it looks like you are trying to scan a Github Enterprise repo/gist. Therefore, you need to provide the enterpriseURL flag as well")
+			os.Exit(exitFatal)
 		}
 	} else if teamName != "" && org == "" {
-		fmt.Println("Can't have a teamName without an org! Please provide a value for org along with the team name")
-		os.Exit(2)
+		fmt.Fprintln(console, "Can't have a teamName without an org! Please provide a value for org along with the team name")
+		os.Exit(exitFatal)
 	} else if orgOnly && org == "" {
-		fmt.Println("orgOnly flag should be used with a valid org")
-		os.Exit(2)
+		fmt.Fprintln(console, "orgOnly flag should be used with a valid org")
+		os.Exit(exitFatal)
 	} else if scanPrivateReposOnly && user == "" && repoURL == "" && org == "" {
-		fmt.Println("scanPrivateReposOnly flag should be used along with either the user, org or the repoURL")
-		os.Exit(2)
+		fmt.Fprintln(console, "scanPrivateReposOnly flag should be used along with either the user, org or the repoURL")
+		os.Exit(exitFatal)
+	} else if scanPrivateReposOnly && *appID != 0 && (user != "" || repoURL != "" || org != "") {
+		fmt.Fprintln(console, "scanPrivateReposOnly flag is provided while authenticating as a Github App, so the private repos the app installation has access to are scanned")
+
+		err := checkifsshkeyexists()
+		if err != nil {
+			return err
+		}
 	} else if scanPrivateReposOnly && (user != "" || repoURL != "" || org != "") {
-		fmt.Println("scanPrivateReposOnly flag is provided with either the user, the repoURL or the org")
+		fmt.Fprintln(console, "scanPrivateReposOnly flag is provided with either the user, the repoURL or the org")
 
 		err := checkifsshkeyexists()
-		check(err)
+		if err != nil {
+			return err
+		}
 
 		//Authenticating to Github using the token
 		ctx1 := context.Background()
 		client1, err := authenticatetogit(ctx1, token)
-		check(err)
+		if err != nil {
+			return err
+		}
 
 		if user != "" || repoURL != "" {
 			var userRepos []*github.Repository
@@ -725,7 +885,9 @@ func checkflags(token string, org string, user string, repoURL string, gistURL s
 
 			for {
 				uRepos, resp, err := client1.Repositories.List(ctx1, "", opt3)
-				check(err)
+				if err != nil {
+					return err
+				}
 				userRepos = append(userRepos, uRepos...) //adding to the userRepos array
 				if resp.NextPage == 0 {
 					break
@@ -734,26 +896,28 @@ func checkflags(token string, org string, user string, repoURL string, gistURL s
 			}
 
 			if user != "" {
-				fmt.Println("scanPrivateReposOnly flag is provided along with the user")
-				fmt.Println("Checking to see if the token provided belongs to the user or not..")
+				fmt.Fprintln(console, "scanPrivateReposOnly flag is provided along with the user")
+				fmt.Fprintln(console, "Checking to see if the token provided belongs to the user or not..")
 
 				if *userRepos[0].Owner.Login == user {
-					fmt.Println("Token belongs to the user")
+					fmt.Fprintln(console, "Token belongs to the user")
 				} else {
-					fmt.Println("Token does not belong to the user. Please provide the correct token for the user mentioned.")
-					os.Exit(2)
+					fmt.Fprintln(console, "Token does not belong to the user. Please provide the correct token for the user mentioned.")
+					os.Exit(exitFatal)
 				}
 
 			} else if repoURL != "" {
-				fmt.Println("scanPrivateReposOnly flag is provided along with the repoURL")
-				fmt.Println("Checking to see if the repo provided belongs to the user or not..")
+				fmt.Fprintln(console, "scanPrivateReposOnly flag is provided along with the repoURL")
+				fmt.Fprintln(console, "Checking to see if the repo provided belongs to the user or not..")
 				val, err := stringInSlice(repoURL, userRepos)
-				check(err)
+				if err != nil {
+					return err
+				}
 				if val {
-					fmt.Println("Repo belongs to the user provided")
+					fmt.Fprintln(console, "Repo belongs to the user provided")
 				} else {
-					fmt.Println("Repo does not belong to the user whose token is provided. Please provide a valid repoURL that belongs to the user whose token is provided.")
-					os.Exit(2)
+					fmt.Fprintln(console, "Repo does not belong to the user whose token is provided. Please provide a valid repoURL that belongs to the user whose token is provided.")
+					os.Exit(exitFatal)
 				}
 			}
 		} else if org != "" && teamName == "" {
@@ -766,7 +930,9 @@ func checkflags(token string, org string, user string, repoURL string, gistURL s
 
 			for {
 				repos, resp, err := client1.Repositories.ListByOrg(ctx1, org, opt3)
-				check(err)
+				if err != nil {
+					return err
+				}
 				orgRepos = append(orgRepos, repos...)
 				if resp.NextPage == 0 {
 					break
@@ -774,44 +940,71 @@ func checkflags(token string, org string, user string, repoURL string, gistURL s
 				opt3.Page = resp.NextPage
 			}
 
-			fmt.Println("scanPrivateReposOnly flag is provided along with the org")
-			fmt.Println("Checking to see if the token provided belongs to a user in the org or not..")
+			fmt.Fprintln(console, "scanPrivateReposOnly flag is provided along with the org")
+			fmt.Fprintln(console, "Checking to see if the token provided belongs to a user in the org or not..")
 
 			var i int
 			if i >= 0 && i < len(orgRepos) {
-				fmt.Println("Private Repos exist in this org and token belongs to a user in this org")
+				fmt.Fprintln(console, "Private Repos exist in this org and token belongs to a user in this org")
 			} else {
-				fmt.Println("Even though the token belongs to a user in this org, there are no Private repos in this org")
-				os.Exit(2)
+				fmt.Fprintln(console, "Even though the token belongs to a user in this org, there are no Private repos in this org")
+				os.Exit(exitFatal)
 			}
 
 		}
 
 	} else if scanPrivateReposOnly && gistURL != "" {
-		fmt.Println("scanPrivateReposOnly flag should NOT be provided with the gistURL since its a private repository or multiple private repositories that we are looking to scan. Please provide either a user, an org or a private repoURL")
-		os.Exit(2)
+		fmt.Fprintln(console, "scanPrivateReposOnly flag should NOT be provided with the gistURL since its a private repository or multiple private repositories that we are looking to scan. Please provide either a user, an org or a private repoURL")
+		os.Exit(exitFatal)
 	} else if !(toolName == "thog" || toolName == "repo-supervisor" || toolName == "all") {
-		fmt.Println("Please enter either thog or repo-supervisor. Default is all.")
-		os.Exit(2)
-	} else if repoURL != "" && !scanPrivateReposOnly && enterpriseURL == "" {
+		fmt.Fprintln(console, "Please enter either thog or repo-supervisor. Default is all.")
+		os.Exit(exitFatal)
+	} else if repoURL != "" && !scanPrivateReposOnly && enterpriseURL == "" && *cloneProtocol != "https" {
 		if strings.Split(repoURL, "@")[0] == "git" {
-			fmt.Println("Since the repoURL is a SSH URL and no enterprise URL is provided, it is required to have the scanPrivateReposOnly flag and the SSH key mounted on a volume")
-			os.Exit(2)
+			fmt.Fprintln(console, "Since the repoURL is a SSH URL and no enterprise URL is provided, it is required to have the scanPrivateReposOnly flag and the SSH key mounted on a volume")
+			os.Exit(exitFatal)
 		}
 	} else if enterpriseURL != "" {
-		fmt.Println("Since enterpriseURL is provided, checking to see if the SSH key is also mounted or not")
+		fmt.Fprintln(console, "Since enterpriseURL is provided, checking to see if the SSH key is also mounted or not")
 
 		err := checkifsshkeyexists()
-		check(err)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func checkcommand(command string, baselineFile string, acceptedBy string, acceptReason string) error {
+	switch command {
+	case "scan":
+	case "baseline":
+		if baselineFile == "" || acceptedBy == "" || acceptReason == "" {
+			fmt.Fprintln(console, "The baseline command needs the baseline file to write along with who accepted the findings and why. Please provide the baseline, acceptedBy and acceptReason flags")
+			os.Exit(exitFatal)
+		}
+	case "retry-failed":
+	default:
+		fmt.Fprintln(console, "Unknown command "+command+". Commands are scan (default), baseline and retry-failed")
+		os.Exit(exitFatal)
 	}
 
+	// The exit code of every command depends on it
+	if !(*failOn == "none" || severityRank(*failOn) >= 0) {
+		fmt.Fprintln(console, "Please enter either low, medium, high, critical or none as the failOn severity. Default is low.")
+		os.Exit(exitFatal)
+	}
+	if _, err := parseSize(*maxDisk); err != nil {
+		fmt.Fprintln(console, "Please enter the maxDisk budget as a size such as 500M or 20G:", err)
+		os.Exit(exitFatal)
+	}
 	return nil
 }
 
 func makeDirectories() error {
-	os.MkdirAll("/tmp/repos/org", 0700)
-	os.MkdirAll("/tmp/repos/team", 0700)
-	os.MkdirAll("/tmp/repos/users", 0700)
+	os.MkdirAll(reposDir, 0700)
+	os.MkdirAll(resultsDir, 0700)
 
 	return nil
 }
@@ -828,13 +1021,21 @@ func findTeamByName(ctx context.Context, client *github.Client, org string, team
 	listTeamsOpts := &github.ListOptions{
 		PerPage: 10,
 	}
+	var found *github.Team
+	if scanCheckpoint.listing("orgs/"+org+"/teams/"+teamName, &found) {
+		return found, nil
+	}
+
 	Info("Listing teams...")
 	for {
 		teams, resp, err := client.Organizations.ListTeams(ctx, org, listTeamsOpts)
-		check(err)
+		if err != nil {
+			return nil, err
+		}
 		//check the name here--try to avoid additional API calls if we've found the team
 		for _, team := range teams {
 			if *team.Name == teamName {
+				scanCheckpoint.saveListing("orgs/"+org+"/teams/"+teamName, team)
 				return team, nil
 			}
 		}
@@ -846,101 +1047,206 @@ func findTeamByName(ctx context.Context, client *github.Client, org string, team
 	return nil, nil
 }
 
-func cloneTeamRepos(ctx context.Context, client *github.Client, org string, teamName string) error {
+func cloneTeamRepos(ctx context.Context, client *github.Client, org string, teamName string, p *pipeline) error {
 
 	// var team *github.Team
 	team, err := findTeamByName(ctx, client, org, teamName)
 
 	if team != nil {
 		Info("Cloning the repositories of the team: " + *team.Name + "(" + strconv.FormatInt(*team.ID, 10) + ")")
-		var teamRepos []*github.Repository
-		listTeamRepoOpts := &github.ListOptions{
-			PerPage: 10,
-		}
 
 		Info("Listing team repositories...")
-		for {
-			repos, resp, err := client.Organizations.ListTeamRepos(ctx, *team.ID, listTeamRepoOpts)
-			check(err)
-			teamRepos = append(teamRepos, repos...) //adding to the repo array
-			if resp.NextPage == 0 {
-				break
-			}
-			listTeamRepoOpts.Page = resp.NextPage
-		}
-
-		var teamrepowg sync.WaitGroup
+		teamRepos, err := listRepos(ctx, client, "teams/"+strconv.FormatInt(*team.ID, 10)+"/repos", url.Values{})
 
 		//iterating through the repo array
-		for _, repo := range teamRepos {
-			teamrepowg.Add(1)
-			go executeclone(repo, "/tmp/repos/team/"+*repo.Name, &teamrepowg)
+		for _, repo := range selectRepos(teamRepos) {
+			queueRepo(p, &repo.Repository, org)
 		}
 
-		teamrepowg.Wait()
-
-	} else {
-		fmt.Println("Unable to find the team '" + teamName + "'; perhaps the user is not a member?\n")
 		if err != nil {
-			fmt.Println("Error was:")
-			fmt.Println(err)
+			return fmt.Errorf("listing the repos of the team %s: %v", teamName, err)
 		}
-		os.Exit(2)
+
+	} else if err != nil {
+		return fmt.Errorf("listing the teams of %s: %v", org, err)
+	} else {
+		return fmt.Errorf("unable to find the team '%s'; perhaps the user is not a member?", teamName)
 	}
 	return nil
 }
 
-func scanTeamRepos(org string) error {
-	err := scanDir("/tmp/repos/team/", org)
-	check(err)
-	return nil
+func authenticatetogit(ctx context.Context, token string) (*github.Client, error) {
+	//Authenticating to Github as the Github App, or using the tokens which the API calls are spread over
+	if appTokens != nil {
+		return newGithubClient(oauth2.NewClient(ctx, appTokens))
+	}
+	if apiTokens == nil {
+		apiTokens = newTokenPool(token)
+	}
+	return newGithubClient(&http.Client{Transport: apiTokens})
 }
 
-func authenticatetogit(ctx context.Context, token string) (*github.Client, error) {
+func newGithubClient(httpClient *http.Client) (*github.Client, error) {
 	var client *github.Client
 	var err error
 
-	//Authenticating to Github using the token
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: token},
-	)
-	tc := oauth2.NewClient(ctx, ts)
+	//Waiting out the rate limits instead of failing
+	httpClient = &http.Client{Transport: newRateLimitTransport(httpClient.Transport)}
 
 	if *enterpriseURL == "" {
-		client = github.NewClient(tc)
+		client = github.NewClient(httpClient)
 	} else if *enterpriseURL != "" {
-		client, err = github.NewEnterpriseClient(*enterpriseURL, *enterpriseURL, tc)
+		client, err = github.NewEnterpriseClient(*enterpriseURL, *enterpriseURL, httpClient)
 		if err != nil {
-			fmt.Printf("NewEnterpriseClient returned unexpected error: %v", err)
+			fmt.Fprintf(console, "NewEnterpriseClient returned unexpected error: %v", err)
 		}
 	}
 	return client, nil
 }
 
 func main() {
+	os.Exit(run())
+}
+
+// run scans and returns the exit code. The deferred cleanups run before main exits with it.
+func run() int {
+
+	//Parsing the command and the flags
+	command := "scan"
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		command = os.Args[1]
+		flag.CommandLine.Parse(os.Args[2:])
+	} else {
+		flag.Parse()
+	}
+
+	//The flags of the command line take precedence over the config file
+	if *configFile != "" {
+		err := applyConfigFile(*configFile)
+		if err != nil {
+			return fatal(err)
+		}
+	}
+
+	err := checkcommand(command, *baselineFile, *acceptedBy, *acceptReason)
+	if err != nil {
+		return fatal(err)
+	}
+
+	//Making sure git, the scanners and their rules can be found
+	checkTools(*toolName)
+
+	//The clones are kept within the disk budget
+	diskSize, _ := parseSize(*maxDisk)
+	clonesDisk = newDiskBudget(diskSize)
+
+	//The first SIGINT or SIGTERM stops the scan and writes a partial report, the second one exits right away
+	handleSignals()
+
+	repoFilters, err = newRepoFilter(*includeRepos, *excludeRepos, *blacklist)
+	if err != nil {
+		return fatal(err)
+	}
+	repoMetadata, err = newMetadataFilter(*archived, *skipDisabled, *visibility, *languages, *topics, *minSize, *maxSize, *pushedAfter)
+	if err != nil {
+		return fatal(err)
+	}
 
-	//Parsing the flags
-	flag.Parse()
+	if *orgConfig != "" {
+		orgSettings, err = readScanConfig(*orgConfig)
+		if err != nil {
+			return fatal(err)
+		}
+	}
 
-	executionQueue = make(chan bool, *threads)
+	//The baseline is read before scanning so that an invalid one does not waste the scan
+	var b *baseline
+	if *baselineFile != "" {
+		b, err = loadBaseline(*baselineFile)
+		if err != nil {
+			return fatal(err)
+		}
+	}
+
+	//Authenticating as a Github App if the appID is provided
+	err = setupGithubApp(runCtx)
+	if err != nil {
+		return fatal(err)
+	}
 
-	//Logic to check the program is ingesting proper flags
-	err := checkflags(*token, *org, *user, *repoURL, *gistURL, *teamName, *scanPrivateReposOnly, *orgOnly, *toolName, *enterpriseURL, *thogEntropy)
-	check(err)
+	//Logic to check the program is ingesting proper flags. The retry-failed command takes the repos from the ledger
+	if command != "retry-failed" {
+		err = checkflags(*token, *org, *user, *repoURL, *gistURL, *teamName, *scanPrivateReposOnly, *orgOnly, *toolName, *enterpriseURL, *thogEntropy, *format)
+		if err != nil {
+			return fatal(err)
+		}
+	}
 
-	ctx := context.Background()
+	ctx := runCtx
 
 	//authN
 	client, err := authenticatetogit(ctx, *token)
-	check(err)
+	if err != nil {
+		return fatal(err)
+	}
 
-	//Creating some temp directories to store repos & results. These will be deleted in the end
+	//The retry-failed command and the resume flag reuse the working directory of the previous run
+	ledgerPath := *ledger
+	if ledgerPath == "" {
+		ledgerPath = ledgerFile()
+	}
+	dir, temporary, err := setupWorkDir(command, ledgerPath)
+	if err != nil {
+		return fatal(err)
+	}
+	failures.WorkDir = dir
+	Info("Cloning the repos and writing the results in: " + dir)
+
+	//The temporary working directory is removed in the end, unless there is something left to resume or retry
+	removeWorkDir := func() {
+		if temporary && !interrupted() && failures.count() == 0 {
+			os.RemoveAll(dir)
+		}
+	}
+
+	//Creating some directories to store repos & results
 	err = makeDirectories()
-	check(err)
+	if err != nil {
+		return fatal(err)
+	}
+
+	//The token is used to clone over HTTPS
+	removeAskpass, err := setupAskpass()
+	if err != nil {
+		return fatal(err)
+	}
+	defer removeAskpass()
+
+	//A passphrase protected SSH key is added to a private ssh-agent
+	stopAgent, err := setupSSH()
+	if err != nil {
+		return fatal(err)
+	}
+	defer stopAgent()
+
+	//The progress of the scan is checkpointed so that it can be resumed if it dies
+	if command != "retry-failed" {
+		scanCheckpoint, err = openCheckpoint(checkpointFile(), *resume, dir)
+		if err != nil {
+			return fatal(err)
+		}
+		defer scanCheckpoint.close()
+	}
 
 	//By now, we either have the org, user, repoURL or the gistURL. The program flow changes accordingly..
 
-	if *org != "" { //If org was supplied
+	if command == "retry-failed" { //If the failures of a previous run are retried
+		err := retryfailed(ledgerPath)
+		if err != nil {
+			return fatal(err)
+		}
+
+	} else if *org != "" { //If org was supplied
 		m := "Since org was provided, the tool will proceed to scan all the org repos, then all the user repos and user gists in a recursive manner"
 
 		if *orgOnly {
@@ -949,22 +1255,31 @@ func main() {
 
 		Info(m)
 
-		//cloning all the repos of the org
-		err := cloneorgrepos(ctx, client, *org)
-		check(err)
+		//Every repo is cloned, scanned and cleaned up as soon as it is listed
+		p := newPipeline()
+
+		//cloning all the repos of the org. Listing failures are recorded and the scan goes on with what was listed
+		err := cloneorgrepos(ctx, client, *org, p)
+		if err != nil {
+			recordListFailure(*org, err)
+		}
 
 		if *teamName != "" { //If team was supplied
 			Info("Since team name was provided, the tool will clone all repos to which the team has access")
 
 			//cloning all the repos of the team
-			err := cloneTeamRepos(ctx, client, *org, *teamName)
-			check(err)
+			err := cloneTeamRepos(ctx, client, *org, *teamName, p)
+			if err != nil {
+				recordListFailure(*org, err)
+			}
 
 		}
 
 		//getting all the users of the org into the allUsers array
 		allUsers, err := listallusers(ctx, client, *org)
-		check(err)
+		if err != nil {
+			recordListFailure(*org, err)
+		}
 
 		if !*orgOnly {
 
@@ -972,81 +1287,70 @@ func main() {
 			for _, user := range allUsers {
 
 				//cloning all the repos of a user
-				err1 := cloneuserrepos(ctx, client, *user.Login)
-				check(err1)
+				err1 := cloneuserrepos(ctx, client, *user.Login, p)
+				if err1 != nil {
+					recordListFailure(*user.Login, err1)
+				}
 
 				//cloning all the gists of a user
-				err2 := cloneusergists(ctx, client, *user.Login)
-				check(err2)
+				err2 := cloneusergists(ctx, client, *user.Login, p)
+				if err2 != nil {
+					recordListFailure(*user.Login, err2)
+				}
 
 			}
 		}
 
-		Info("Scanning all org repositories now..This may take a while so please be patient\n")
-		err = scanorgrepos(*org)
-		check(err)
-		Info("Finished scanning all org repositories\n")
+		Info("Everything was listed, waiting for the remaining repositories to be cloned and scanned..This may take a while so please be patient\n")
+		p.wait()
+		Info("Finished scanning all repositories and gists\n")
 
-		if *teamName != "" { //If team was supplied
-			Info("Scanning all team repositories now...This may take a while so please be patient\n")
-			err = scanTeamRepos(*org)
-			check(err)
+	} else if *user != "" { //If user was supplied
+		Info("Since user was provided, the tool will proceed to scan all the user repos and user gists\n")
+		p := newPipeline()
 
-			Info("Finished scanning all team repositories\n")
+		err1 := cloneuserrepos(ctx, client, *user, p)
+		if err1 != nil {
+			recordListFailure(*user, err1)
 		}
 
-		if !*orgOnly {
-
-			Info("Scanning all user repositories and gists now..This may take a while so please be patient\n")
-			var wguser sync.WaitGroup
-			for _, user := range allUsers {
-				wguser.Add(1)
-				go scanforeachuser(*user.Login, &wguser)
-			}
-			wguser.Wait()
-			Info("Finished scanning all user repositories and gists\n")
+		err2 := cloneusergists(ctx, client, *user, p)
+		if err2 != nil {
+			recordListFailure(*user, err2)
 		}
 
-	} else if *user != "" { //If user was supplied
-		Info("Since user was provided, the tool will proceed to scan all the user repos and user gists\n")
-		err1 := cloneuserrepos(ctx, client, *user)
-		check(err1)
-
-		err2 := cloneusergists(ctx, client, *user)
-		check(err2)
-
-		Info("Scanning all user repositories and gists now..This may take a while so please be patient\n")
-		var wguseronly sync.WaitGroup
-		wguseronly.Add(1)
-		go scanforeachuser(*user, &wguseronly)
-		wguseronly.Wait()
+		Info("Everything was listed, waiting for the remaining repositories and gists to be cloned and scanned..This may take a while so please be patient\n")
+		p.wait()
 		Info("Finished scanning all user repositories and gists\n")
 
 	} else if *repoURL != "" || *gistURL != "" { //If either repoURL or gistURL was supplied
 
-		var url, repoorgist, fpath, rn, lastString, orgoruserName string
+		var url, repoorgist, rn, lastString, orgoruserName string
 		var splitArray []string
-		var bpath = "/tmp/repos/"
 
 		if *repoURL != "" { //repoURL
-			if *enterpriseURL != "" && strings.Split(strings.Split(*repoURL, "/")[0], "@")[0] != "git" {
+			if *cloneProtocol == "https" {
+				url = httpsURL(*repoURL)
+			} else if *enterpriseURL != "" && strings.Split(strings.Split(*repoURL, "/")[0], "@")[0] != "git" {
 				url = "git@" + strings.Split(*repoURL, "/")[2] + ":" + strings.Split(*repoURL, "/")[3] + "/" + strings.Split(*repoURL, "/")[4]
 			} else {
 				url = *repoURL
 			}
-			repoorgist = "repo"
+			repoorgist = repoKind
 		} else { //gistURL
-			if *enterpriseURL != "" && strings.Split(strings.Split(*gistURL, "/")[0], "@")[0] != "git" {
+			if *cloneProtocol == "https" {
+				url = httpsURL(*gistURL)
+			} else if *enterpriseURL != "" && strings.Split(strings.Split(*gistURL, "/")[0], "@")[0] != "git" {
 				url = "git@" + strings.Split(*gistURL, "/")[2] + ":" + strings.Split(*gistURL, "/")[3] + "/" + strings.Split(*gistURL, "/")[4]
 			} else {
 				url = *gistURL
 			}
-			repoorgist = "gist"
+			repoorgist = gistKind
 		}
 
 		Info("The tool will proceed to clone and scan: " + url + " only\n")
 
-		if *enterpriseURL == "" && strings.Split(strings.Split(*gistURL, "/")[0], "@")[0] == "git" {
+		if *cloneProtocol != "https" && *enterpriseURL == "" && strings.Split(strings.Split(*gistURL, "/")[0], "@")[0] == "git" {
 			splitArray = strings.Split(url, ":")
 			lastString = splitArray[len(splitArray)-1]
 		} else {
@@ -1054,7 +1358,9 @@ func main() {
 			lastString = splitArray[len(splitArray)-1]
 		}
 
-		if !*scanPrivateReposOnly {
+		if *cloneProtocol == "https" {
+			orgoruserName = splitArray[3]
+		} else if !*scanPrivateReposOnly {
 			if *enterpriseURL != "" {
 				orgoruserName = strings.Split(splitArray[0], ":")[1]
 			} else {
@@ -1069,51 +1375,102 @@ func main() {
 		}
 
 		switch repoorgist {
-		case "repo":
+		case repoKind:
 			rn = strings.Split(lastString, ".")[0]
-		case "gist":
+		case gistKind:
 			rn = lastString
 		}
-		fpath = bpath + orgoruserName + "/" + rn
 
-		//cloning
-		Info("Starting to clone: " + url + "\n")
-		var wgo sync.WaitGroup
-		wgo.Add(1)
-		func(url string, fpath string, wgo *sync.WaitGroup) {
-			enqueueJob(func() {
-				gitclone(url, fpath, wgo)
-			})
-		}(url, fpath, &wgo)
-		wgo.Wait()
-		Info("Cloning of: " + url + " finished\n")
-
-		//scanning
-		Info("Starting to scan: " + url + "\n")
-		var wgs sync.WaitGroup
-		wgs.Add(1)
-
-		func(rn string, fpath string, wgs *sync.WaitGroup, orgoruserName string) {
-			enqueueJob(func() {
-				runGitTools(*toolName, fpath+"/", wgs, rn, orgoruserName)
-			})
-		}(rn, fpath, &wgs, orgoruserName)
+		//cloning and scanning, unless the clone failed and is already in the failure ledger
+		Info("Starting to clone and scan: " + url + "\n")
+		p := newPipeline()
+		p.add(repoJob{URL: url, ID: newRepoID(orgoruserName, repoorgist, rn)})
+		p.wait()
+		Info("Cloning and scanning of: " + url + " finished\n")
 
-		wgs.Wait()
-		Info("Scanning of: " + url + " finished\n")
+	}
+
+	//Now, that all the scanning has finished, time to combine the output. The findings were read and filtered
+	//as the repos left the pipeline, and result files that can't be read are recorded as failures
+	findings, suppressed := collected.report()
 
+	if suppressed[pathFiltersReason] > 0 {
+		Info("%d findings were excluded by the includePaths and excludePaths flags\n", suppressed[pathFiltersReason])
+	}
+	if suppressed[linguistReason] > 0 {
+		Info("%d findings were skipped in files tagged linguist-vendored or linguist-generated\n", suppressed[linguistReason])
+	}
+	if suppressed[repoConfigName] > 0 {
+		Info("%d findings were suppressed by the %s files of the repos\n", suppressed[repoConfigName], repoConfigName)
+	}
+	if suppressed[allowAnnotation]+suppressed[ignoreFileName] > 0 {
+		Info("%d findings were suppressed by %s annotations and %d by %s files\n", suppressed[allowAnnotation], allowAnnotation, suppressed[ignoreFileName], ignoreFileName)
 	}
 
-	//Now, that all the scanning has finished, time to combine the output
-	// There are two option here:
-	if *mergeOutput {
-		// The first is to merge everything in /tmp/results into one JSON file
+	if interrupted() {
+		Info("The scan was interrupted, so the report is incomplete. The repos that were not cloned or scanned are in the failure ledger\n")
+	}
+
+	//Record the repos that could not be listed, cloned, scanned or read
+	failures.Incomplete = interrupted()
+	err = failures.write(ledgerFile())
+	if err != nil {
+		fmt.Fprintln(console, "Could not write the failure ledger:", err)
+	}
+	if failures.count() > 0 {
+		Info("%d repos could not be cloned or scanned, they are listed in %s. Use the retry-failed command to retry them\n", failures.count(), ledgerFile())
+	}
+
+	if b != nil {
+		if command == "baseline" {
+			added := b.add(findings, *acceptedBy, *acceptReason)
+			err = b.write(*baselineFile)
+			if err != nil {
+				return fatal(err)
+			}
+			Info("Added %d findings to the baseline %s (%d entries in total)\n", added, *baselineFile, len(b.Entries))
+			scanCheckpoint.remove()
+			removeWorkDir()
+			return exitClean
+		}
+
+		findings, suppressed["baseline"] = b.filter(findings)
+		Info("%d findings were suppressed by the baseline %s\n", suppressed["baseline"], *baselineFile)
+	}
+
+	// There are three options here:
+	if *format == "html" {
+		// The first is a self-contained HTML report grouped by org/user and repo
+		Info("Writing the HTML report\n")
+		err = writeHTMLReport(findings, suppressed, failures.entries(), interrupted(), *outputFile)
+		if err != nil {
+			return fatal(err)
+		}
+	} else if *mergeOutput || *format == "json" {
+		// The second is to merge everything in the resultsDir into one JSON file
 		Info("Merging the output into one JSON file\n")
-		mergeOutputJSON(*outputFile)
+		err = mergeOutputJSON(findings, *outputFile)
+		if err != nil {
+			return fatal(err)
+		}
 	} else {
-		// The second is to just concat the outputs
+		// The third is to just concat the outputs
 		Info("Combining the output into one file\n")
-		err = combineOutput(*toolName, *outputFile)
-		check(err)
+		err = combineOutput(*toolName, findings, failures.entries(), interrupted(), *outputFile)
+		if err != nil {
+			return fatal(err)
+		}
+	}
+
+	//The checkpoint is only needed to resume an interrupted scan
+	if !interrupted() {
+		scanCheckpoint.remove()
+	}
+	removeWorkDir()
+
+	//The exit code tells whether there are findings at or above failOn, or repos that could not be scanned
+	if count := failing(findings, *failOn); count > 0 {
+		Info("%d findings are at or above the %s severity\n", count, *failOn)
 	}
+	return exitCode(findings, *failOn, failures.count())
 }
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var unsafePathChars = regexp.MustCompile(`[^A-Za-z0-9._/-]`)
+
+// mirrorPath returns where the bare mirror of a clone URL is kept in the cache directory,
+// for instance <cacheDir>/github.com/org/repo.git for both the https and the ssh URL
+func mirrorPath(cloneURL string) string {
+	p := cloneURL
+	if i := strings.Index(p, "://"); i >= 0 {
+		p = p[i+3:]
+	} else if strings.Contains(p, "@") && strings.Contains(p, ":") {
+		// git@github.com:org/repo.git
+		p = strings.Replace(strings.SplitN(p, "@", 2)[1], ":", "/", 1)
+	}
+	if i := strings.Index(p, "@"); i >= 0 && i < strings.Index(p, "/") {
+		p = p[i+1:]
+	}
+	p = strings.TrimSuffix(strings.TrimSuffix(p, "/"), ".git")
+	p = unsafePathChars.ReplaceAllString(strings.Replace(p, "..", "_", -1), "_")
+	return filepath.Join(*cacheDir, p+".git")
+}
+
+// lockMirror takes an exclusive lock on the mirror so that concurrent runs sharing the cache
+// directory don't update it at the same time. The lock is released by closing the file. While
+// another run holds it, the lock is polled so that a canceled run does not keep waiting.
+func lockMirror(ctx context.Context, mirror string) (*os.File, error) {
+	os.MkdirAll(filepath.Dir(mirror), 0700)
+	lock, err := os.OpenFile(mirror+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			return lock, nil
+		}
+		if err != syscall.EWOULDBLOCK {
+			lock.Close()
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			lock.Close()
+			return nil, ctx.Err()
+		case <-time.After(mirrorLockPoll):
+		}
+	}
+}
+
+// How often a mirror locked by another run is checked
+const mirrorLockPoll = 500 * time.Millisecond
+
+func rungit(ctx context.Context, args ...string) error {
+	cmd := exec.Command(*gitPath, append(gitConfigArgs(), args...)...)
+	cmd.Env = gitEnv()
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := runCommand(ctx, cmd); err != nil {
+		return fmt.Errorf("git %s: %v: %s", args[0], err, stderr.String())
+	}
+	return nil
+}
+
+// cloneMirror creates the bare mirror of the repo, which is removed if the clone fails
+func cloneMirror(ctx context.Context, cloneURL string, mirror string) error {
+	err := rungit(ctx, append(append([]string{"clone", "--mirror"}, cloneStrategyArgs()...), cloneURL, mirror)...)
+	if err == nil && *cloneStrategy == "blobless" {
+		err = rungit(ctx, "-C", mirror, "config", "uploadpack.allowFilter", "true")
+	}
+	if err != nil {
+		os.RemoveAll(mirror)
+	}
+	return err
+}
+
+// mirrorclone updates the bare mirror of the repo in the cache directory, or creates it on
+// the first run, and checks out a working copy for the scanners from it. A mirror that can't
+// be updated, such as one left half-written by a killed run, is cloned again.
+func mirrorclone(ctx context.Context, cloneURL string, repoName string) error {
+	mirror := mirrorPath(cloneURL)
+
+	lock, err := lockMirror(ctx, mirror)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	if fileExists(mirror) {
+		args := fetchStrategyArgs()
+		if *cloneStrategy == "full" && truncatedHistory(mirror) != "" {
+			// The mirror was cloned with a shallow strategy by an earlier run
+			args = []string{"--unshallow"}
+		}
+		err = rungit(ctx, append([]string{"-C", mirror, "fetch", "--prune"}, append(args, "origin")...)...)
+		if err != nil && ctx.Err() == nil {
+			Info("Updating the mirror " + mirror + " failed, cloning it again")
+			fmt.Fprintln(console, err)
+			os.RemoveAll(mirror)
+			err = cloneMirror(ctx, cloneURL, mirror)
+		}
+	} else {
+		err = cloneMirror(ctx, cloneURL, mirror)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch *cloneStrategy {
+	case "full":
+		// --local hardlinks the objects so the working copy does not depend on the mirror
+		// which might be pruned by a later run
+		err = rungit(ctx, "clone", "--local", mirror, repoName)
+	case "blobless":
+		// The mirror does not have the blobs either, so the working copy is checked out once
+		// its origin points to the actual remote to fetch them from
+		err = rungit(ctx, "clone", "--no-local", "--filter=blob:none", "--no-checkout", "file://"+mirror, repoName)
+	default:
+		err = rungit(ctx, "clone", "--no-local", "--no-single-branch", "file://"+mirror, repoName)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = rungit(ctx, "-C", repoName, "remote", "set-url", "origin", cloneURL)
+	if err == nil && *cloneStrategy == "blobless" {
+		err = rungit(ctx, "-C", repoName, "checkout", "--quiet")
+	}
+	return err
+}
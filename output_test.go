@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// The JSON output keeps the array of repositories with their stringsFound, whether or not the scan completed
+func TestMergeOutputJSON(t *testing.T) {
+	file, err := ioutil.TempFile("", "git-all-secrets-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+
+	f := finding{Host: "github.com", OrgOrUser: "acme", Kind: repoKind, Repo: "api", RepoURL: "git@github.com:acme/api.git", Rule: "AWS API Key", Path: "config.yml", Secret: "AKIA"}
+	f.Fingerprint = f.fingerprint()
+	if err := mergeOutputJSON([]finding{f, f}, file.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var output []struct {
+		Repository   string              `json:"repository"`
+		StringsFound map[string][]string `json:"stringsFound"`
+		Secrets      []map[string]string `json:"secrets"`
+	}
+	if err := json.Unmarshal(content, &output); err != nil {
+		t.Fatalf("the output is not an array of repositories: %v\n%s", err, content)
+	}
+	if len(output) != 1 || output[0].Repository != f.RepoURL || len(output[0].StringsFound["config.yml"]) != 1 {
+		t.Errorf("output = %s", content)
+	}
+	if len(output[0].Secrets) != 1 || output[0].Secrets[0]["fingerprint"] != f.Fingerprint {
+		t.Errorf("secrets = %v", output[0].Secrets)
+	}
+
+	if err := mergeOutputJSON(nil, file.Name()); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := ioutil.ReadFile(file.Name()); string(content) != "[]" {
+		t.Errorf("output without findings = %s, want []", content)
+	}
+}
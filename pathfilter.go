@@ -0,0 +1,92 @@
+package main
+
+import (
+	"path"
+	"strings"
+)
+
+const pathFiltersReason = "includePaths/excludePaths"
+
+// globMatch matches a slash separated path against a glob where ** matches any number of
+// directories and the other wildcards behave like path.Match within one directory
+func globMatch(pattern string, p string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(p, "/"))
+}
+
+func matchSegments(pattern []string, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(pattern[0], segments[0]); !matched {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
+
+// matchPath reports whether the path relative to the repo root matches the pattern.
+// Like in .gitignore, a pattern without a slash matches in any directory, a pattern
+// with a slash is relative to the repo root and a directory matches everything in it.
+func matchPath(pattern string, p string) bool {
+	anchored := strings.HasPrefix(pattern, "/")
+	pattern = strings.Trim(pattern, "/")
+	if pattern == "" {
+		return false
+	}
+	if !anchored && !strings.Contains(pattern, "/") {
+		pattern = "**/" + pattern
+	}
+	return globMatch(pattern, p) || globMatch(pattern+"/**", p)
+}
+
+func splitPatterns(patterns string) []string {
+	var result []string
+	for _, pattern := range strings.Split(patterns, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			result = append(result, pattern)
+		}
+	}
+	return result
+}
+
+// applyPathFilters drops the findings in paths matching the excludePaths flag or, when the
+// includePaths flag is provided, not matching it. Every tool is filtered the same way since
+// this works on their parsed output.
+func applyPathFilters(findings []finding, suppressed map[string]int) []finding {
+	includes := splitPatterns(*includePaths)
+	excludes := splitPatterns(*excludePaths)
+
+	var kept []finding
+	for _, f := range findings {
+		included := len(includes) == 0
+		for _, pattern := range includes {
+			if matchPath(pattern, f.Path) {
+				included = true
+				break
+			}
+		}
+		for _, pattern := range excludes {
+			if matchPath(pattern, f.Path) {
+				included = false
+				break
+			}
+		}
+
+		if included {
+			kept = append(kept, f)
+		} else {
+			suppressed[pathFiltersReason]++
+		}
+	}
+	return kept
+}
@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		matched bool
+	}{
+		{"*.min.js", "app.min.js", true},
+		{"*.min.js", "static/js/app.min.js", true},
+		{"*.min.js", "app.js", false},
+		{"vendor", "vendor/lib/a.go", true},
+		{"vendor/", "src/vendor/lib/a.go", true},
+		{"vendor", "vendors/a.go", false},
+		{"/vendor", "src/vendor/a.go", false},
+		{"/vendor", "vendor/a.go", true},
+		{"test/fixtures", "test/fixtures/keys.pem", true},
+		{"test/fixtures", "src/test/fixtures/keys.pem", false},
+		{"**/fixtures/*.pem", "a/b/fixtures/keys.pem", true},
+		{"**/fixtures/*.pem", "fixtures/keys.pem", true},
+		{"**/fixtures/*.pem", "fixtures/sub/keys.pem", false},
+		{"docs/**/*.md", "docs/README.md", true},
+		{"docs/**/*.md", "docs/a/b/c.md", true},
+		{"**", "anything/at/all", true},
+		{"/", "a.go", false},
+		{"", "a.go", false},
+		{"config.?ml", "config.yml", true},
+		{"[abc].txt", "d.txt", false},
+	}
+	for _, test := range tests {
+		if matched := matchPath(test.pattern, test.path); matched != test.matched {
+			t.Errorf("matchPath(%q, %q) = %v, want %v", test.pattern, test.path, matched, test.matched)
+		}
+	}
+}
+
+func TestSplitPatterns(t *testing.T) {
+	patterns := splitPatterns(" vendor/, ,*.min.js,")
+	if len(patterns) != 2 || patterns[0] != "vendor/" || patterns[1] != "*.min.js" {
+		t.Errorf("splitPatterns = %q", patterns)
+	}
+}
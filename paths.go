@@ -0,0 +1,198 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Directories of the run, resolved from the workDir and resultsDir flags by setupWorkDir
+var (
+	reposDir   string
+	resultsDir string
+	// thogRulesFile is the rules file of truffleHog, resolved from the rulesFile flag
+	thogRulesFile string
+)
+
+func homeDir() string {
+	if home := os.Getenv("HOME"); home != "" {
+		return home
+	}
+	return "/root"
+}
+
+// applyConfigFile sets the flags found in the YAML file, such as workDir: /data/work, unless
+// they were provided on the command line
+func applyConfigFile(file string) error {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	values := make(map[string]interface{})
+	if err := yaml.Unmarshal(content, &values); err != nil {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+
+	provided := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		provided[f.Name] = true
+	})
+	for name, value := range values {
+		if flag.Lookup(name) == nil {
+			return fmt.Errorf("%s: unknown flag %s", file, name)
+		}
+		if provided[name] {
+			continue
+		}
+		if err := flag.Set(name, fmt.Sprint(value)); err != nil {
+			return fmt.Errorf("%s: invalid value for %s: %v", file, name, err)
+		}
+	}
+	return nil
+}
+
+// findFile returns the first of the candidates that exists
+func findFile(candidates ...string) string {
+	for _, candidate := range candidates {
+		if fileExists(candidate) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// executableDir is where the git-all-secrets binary is, to find the files shipped along with it
+func executableDir() string {
+	executable, err := os.Executable()
+	if err != nil {
+		return "."
+	}
+	return filepath.Dir(executable)
+}
+
+// checkTools makes sure the git binary, the scanners and the rules of truffleHog can be found,
+// looking in the PATH and next to the git-all-secrets binary before the paths of the Docker image
+func checkTools(tool string) {
+	if _, err := exec.LookPath(*gitPath); err != nil {
+		fmt.Fprintln(console, "Could not find git. Please install it or provide its path with the git flag:", err)
+		os.Exit(exitFatal)
+	}
+
+	if tool == "all" || tool == "thog" {
+		if _, err := exec.LookPath(*trufflehogPath); err != nil {
+			fmt.Fprintln(console, "Could not find truffleHog. Please install it or provide its path with the trufflehog flag:", err)
+			os.Exit(exitFatal)
+		}
+	}
+
+	thogRulesFile = *rulesFile
+	if thogRulesFile == "" {
+		thogRulesFile = findFile(filepath.Join(executableDir(), "rules.json"), "rules.json", "/root/truffleHog/rules.json")
+	}
+	if (tool == "all" || tool == "thog") && !fileExists(thogRulesFile) {
+		fmt.Fprintln(console, "Could not find the rules of truffleHog. Please provide them with the rulesFile flag")
+		os.Exit(exitFatal)
+	}
+	rules, err := readRules(thogRulesFile)
+	if err != nil {
+		fmt.Fprintln(console, "Could not read the rules of truffleHog:", err)
+		os.Exit(exitFatal)
+	}
+	fileRules = rules
+
+	if *repoSupervisorPath == "" {
+		if path, err := exec.LookPath("runreposupervisor.sh"); err == nil {
+			*repoSupervisorPath = path
+		} else {
+			*repoSupervisorPath = findFile(filepath.Join(executableDir(), "runreposupervisor.sh"), "/root/repo-supervisor/runreposupervisor.sh")
+		}
+	}
+	if (tool == "all" || tool == "repo-supervisor") && !fileExists(*repoSupervisorPath) {
+		fmt.Fprintln(console, "Could not find runreposupervisor.sh. Please provide its path with the repoSupervisor flag")
+		os.Exit(exitFatal)
+	}
+}
+
+// setupWorkDir picks the working directory of the run: the workDir flag, the one of the scan
+// being resumed or retried, or else a new directory in the temporary directory of the system
+// so that several scans can run on the same host. It tells whether the directory is temporary,
+// in which case it can be removed once nothing is left to resume or retry.
+func setupWorkDir(command string, ledgerPath string) (string, bool, error) {
+	dir := *workDir
+	temporary := dir == ""
+	if temporary {
+		switch {
+		case command == "retry-failed":
+			if previous, err := loadLedger(ledgerPath); err == nil {
+				dir = previous.WorkDir
+			}
+		case *resume:
+			dir = checkpointWorkDir(checkpointFile())
+		}
+		if dir == "" {
+			var err error
+			dir, err = ioutil.TempDir("", "git-all-secrets-")
+			if err != nil {
+				return "", false, err
+			}
+		}
+	}
+	// The directory of the previous run is created again if it was removed since, so that the
+	// paths in its ledger and checkpoint are still valid
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", false, err
+	}
+
+	reposDir = filepath.Join(dir, "repos")
+	resultsDir = *resultsDirFlag
+	if resultsDir == "" {
+		resultsDir = filepath.Join(dir, "results")
+	}
+	return dir, temporary, nil
+}
+
+// workDirMarker is written in the working directories git-all-secrets uses, so that it only ever
+// removes the repos and results directories it created itself
+const workDirMarker = ".git-all-secrets-workdir"
+
+// clearPreviousRun removes the clones and results of a previous run in the working directory,
+// which would make the clones of this run fail and end up in its report. Directories it did not
+// create, such as a resultsDir outside of the working directory, are not removed since they might
+// hold other files, so they must be empty.
+func clearPreviousRun(dir string) error {
+	marker := filepath.Join(dir, workDirMarker)
+	owned := fileExists(marker)
+
+	if entries, _ := ioutil.ReadDir(reposDir); len(entries) > 0 {
+		if !owned {
+			return fmt.Errorf("the workDir %s already has a repos directory that git-all-secrets did not create. Please provide another workDir", dir)
+		}
+		Info("Removing the clones of the previous run in: " + reposDir)
+		if err := os.RemoveAll(reposDir); err != nil {
+			return err
+		}
+	}
+
+	if entries, _ := ioutil.ReadDir(resultsDir); len(entries) > 0 {
+		if resultsDir != filepath.Join(dir, "results") {
+			return fmt.Errorf("the resultsDir %s is not empty, its results would end up in the report. Please empty it or resume the scan that wrote them", resultsDir)
+		}
+		if !owned {
+			return fmt.Errorf("the workDir %s already has a results directory that git-all-secrets did not create. Please provide another workDir", dir)
+		}
+		Info("Removing the results of the previous run in: " + resultsDir)
+		if err := os.RemoveAll(resultsDir); err != nil {
+			return err
+		}
+	}
+
+	if err := makeDirectories(); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(marker, []byte("Working directory of git-all-secrets, its repos and results directories are removed by the next scan\n"), 0644)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Only the repos and results directories of a working directory marked by a previous run are removed
+func TestClearPreviousRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "git-all-secrets-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(repos, results string) { reposDir, resultsDir = repos, results }(reposDir, resultsDir)
+	reposDir, resultsDir = filepath.Join(dir, "repos"), filepath.Join(dir, "results")
+
+	unrelated := filepath.Join(reposDir, "project", "main.go")
+	os.MkdirAll(filepath.Dir(unrelated), 0700)
+	ioutil.WriteFile(unrelated, []byte("package main\n"), 0644)
+	if err := clearPreviousRun(dir); err == nil {
+		t.Error("the repos directory of an unmarked workDir was accepted")
+	}
+	if !fileExists(unrelated) {
+		t.Fatal("a file of an unmarked workDir was removed")
+	}
+
+	// Once the directory is marked, the clones and results of the previous run are removed
+	os.RemoveAll(reposDir)
+	if err := clearPreviousRun(dir); err != nil {
+		t.Fatal(err)
+	}
+	clone := filepath.Join(cloneDir(newRepoID("acme", repoKind, "api")), "README.md")
+	result := resultPath(newRepoID("acme", repoKind, "api"), "truffleHog")
+	for _, file := range []string{clone, result} {
+		os.MkdirAll(filepath.Dir(file), 0700)
+		ioutil.WriteFile(file, nil, 0644)
+	}
+	if err := clearPreviousRun(dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{clone, result} {
+		if fileExists(file) {
+			t.Errorf("%s of the previous run was not removed", file)
+		}
+	}
+	if !fileExists(reposDir) || !fileExists(resultsDir) {
+		t.Error("the repos and results directories were not created again")
+	}
+}
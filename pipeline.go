@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// repoJob is a repo or a gist going through the pipeline
+type repoJob struct {
+	URL string
+	ID  repoID
+	// Dir is where the repo is cloned, set when it is queued
+	Dir string
+	// Size is reserved in the maxDisk budget for the working copy, as reported by Github until it is cloned
+	Size int64
+}
+
+// pipeline moves every repo from cloning to scanning to cleanup as soon as it is ready, each
+// stage with its own number of workers. A stage blocks the previous one when all its workers
+// are busy, so the clones don't pile up on the disk while the scanners catch up.
+type pipeline struct {
+	clones   chan repoJob
+	scans    chan repoJob
+	cleanups chan repoJob
+	done     chan struct{}
+
+	mutex sync.Mutex
+	// queued has the repos already in the pipeline, such as an org repo the team has access to
+	queued map[repoID]bool
+	status *progress
+}
+
+// stageWorkers is the number of workers of a stage, the threads flag unless overridden
+func stageWorkers(workers int) int {
+	if workers > 0 {
+		return workers
+	}
+	return *threads
+}
+
+func newPipeline() *pipeline {
+	p := &pipeline{
+		clones:   make(chan repoJob),
+		scans:    make(chan repoJob, stageWorkers(*scanThreads)),
+		cleanups: make(chan repoJob, stageWorkers(*threads)),
+		done:     make(chan struct{}),
+		queued:   make(map[repoID]bool),
+		status:   startProgress(),
+	}
+
+	cloned := startStage(stageWorkers(*cloneThreads), p.clones, p.clone)
+	scanned := startStage(stageWorkers(*scanThreads), p.scans, p.scan)
+	cleaned := startStage(stageWorkers(*threads), p.cleanups, p.cleanup)
+
+	// Each stage is closed once the previous one has no more repos to hand over
+	go func() {
+		cloned.Wait()
+		close(p.scans)
+		scanned.Wait()
+		close(p.cleanups)
+		cleaned.Wait()
+		close(p.done)
+	}()
+	return p
+}
+
+func startStage(workers int, jobs chan repoJob, work func(repoJob)) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				work(job)
+			}
+		}()
+	}
+	return &wg
+}
+
+// queue tells whether the repo is not in the pipeline yet, in which case it is now
+func (p *pipeline) queue(job *repoJob) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.queued[job.ID] {
+		return false
+	}
+	p.queued[job.ID] = true
+	job.Dir = cloneDir(job.ID)
+	p.status.enumerate()
+	return true
+}
+
+// add queues a repo to be cloned, then scanned
+func (p *pipeline) add(job repoJob) {
+	if p.queue(&job) {
+		p.clones <- job
+	}
+}
+
+// addCloned queues a repo that is already cloned to be scanned
+func (p *pipeline) addCloned(job repoJob) {
+	if p.queue(&job) {
+		job.Size = dirSize(job.Dir)
+		clonesDisk.claim(job.Size)
+		p.status.clone(job.Size)
+		p.scans <- job
+	}
+}
+
+// wait blocks until every repo queued went through the pipeline. No repo can be added after.
+func (p *pipeline) wait() {
+	p.status.allListed()
+	close(p.clones)
+	<-p.done
+	p.status.finish()
+}
+
+func (p *pipeline) clone(job repoJob) {
+	// A previous run saved the findings of the repo and deleted its working copy
+	if scanCheckpoint.finished("cleanup", job.Dir) && fileExists(resultPath(job.ID, savedFindingsFile)) {
+		fmt.Fprintln(console, "Reusing the findings of "+job.URL+" from the checkpoint")
+		p.status.leave()
+		return
+	}
+
+	fmt.Fprintln(console, job.URL)
+	job.Size = clonesDisk.estimate(job.Size)
+	if err := clonesDisk.reserve(job.Size); err != nil {
+		Info("Skipping " + job.URL + ": " + err.Error())
+		failures.record(ledgerEntry{URL: job.URL, Dir: job.Dir, Stage: "clone", Error: err.Error()})
+		p.status.leave()
+		return
+	}
+
+	// Repos that can't be cloned are in the failure ledger and are not scanned
+	if !gitclone(job.URL, job.Dir) {
+		clonesDisk.release(job.Size, true)
+		p.status.leave()
+		return
+	}
+	size := dirSize(job.Dir)
+	clonesDisk.measure(size, job.Size)
+	job.Size = size
+	p.status.clone(size)
+	p.scans <- job
+}
+
+func (p *pipeline) scan(job repoJob) {
+	runGitTools(*toolName, job.Dir+"/", job.ID)
+	p.status.scan()
+	p.cleanups <- job
+}
+
+// cleanup reads the results of the repo into the report while its working copy is still
+// there, since the filters look at its .gitattributes, its configuration and its files. Unless
+// the clones are kept, the findings are then saved and the working copy is deleted.
+func (p *pipeline) cleanup(job repoJob) {
+	deleted := false
+	defer func() {
+		clonesDisk.release(job.Size, deleted)
+		p.status.leave()
+	}()
+	defer recoverFailure(ledgerEntry{URL: job.URL, Dir: job.Dir, Stage: "results"})
+
+	hasResults := fileExists(resultDir(job.ID))
+	var added repoFindings
+	if hasResults {
+		added = collected.add(job.ID)
+	}
+	if *keepClones {
+		return
+	}
+
+	if hasResults {
+		// Without the working copy, the report of a later run can only read the findings back
+		if err := saveFindings(job.ID, added); err != nil {
+			Info("Saving the findings failed for: " + job.ID.String() + ", keeping its clone")
+			fmt.Fprintln(console, err)
+			return
+		}
+	}
+	os.RemoveAll(job.Dir)
+	deleted = true
+
+	if hasResults && scanned(job.Dir) {
+		scanCheckpoint.finish("cleanup", job.Dir)
+	}
+}
+
+// scanned tells whether every tool finished scanning the repo according to the checkpoint
+func scanned(dir string) bool {
+	for _, tool := range resultFiles(*toolName) {
+		if !scanCheckpoint.finished("scan:"+tool, dir) {
+			return false
+		}
+	}
+	return true
+}
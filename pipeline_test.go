@@ -0,0 +1,155 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// testScan runs the pipeline against local repos, with a stand-in truffleHog that logs the repos
+// it scans and reports one AWS key in each of them
+type testScan struct {
+	t   *testing.T
+	dir string
+}
+
+const fakeTrufflehog = `#!/bin/sh
+echo "$1" >> "$(dirname "$0")/scans.log"
+name=$(basename "$1")
+echo '{"branch":"master","commit":"c","commitHash":"abc","date":"2020","diff":"+key=AKIA'$name'","path":"config.yml","printDiff":"","reason":"AWS API Key","stringsFound":["AKIA'$name'"]}'
+exit 1
+`
+
+func newTestScan(t *testing.T) (*testScan, func()) {
+	dir, err := ioutil.TempDir("", "git-all-secrets-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "trufflehog"), []byte(fakeTrufflehog), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	previousDirs := []string{reposDir, resultsDir, thogRulesFile}
+	previousFlags := []string{*toolName, *trufflehogPath, *cloneStrategy, *cacheDir, *linguistFiles}
+	previousInts := []int{*threads, *cloneThreads, *scanThreads, *cloneRetries}
+	previousKeep, previousProgress := *keepClones, *progressInterval
+	previousCheckpoint, previousCollected, previousFailures, previousDisk := scanCheckpoint, collected, failures, clonesDisk
+	restore := func() {
+		reposDir, resultsDir, thogRulesFile = previousDirs[0], previousDirs[1], previousDirs[2]
+		*toolName, *trufflehogPath, *cloneStrategy, *cacheDir, *linguistFiles = previousFlags[0], previousFlags[1], previousFlags[2], previousFlags[3], previousFlags[4]
+		*threads, *cloneThreads, *scanThreads, *cloneRetries = previousInts[0], previousInts[1], previousInts[2], previousInts[3]
+		*keepClones, *progressInterval = previousKeep, previousProgress
+		scanCheckpoint, collected, failures, clonesDisk = previousCheckpoint, previousCollected, previousFailures, previousDisk
+		os.RemoveAll(dir)
+	}
+
+	reposDir, resultsDir, thogRulesFile = filepath.Join(dir, "repos"), filepath.Join(dir, "results"), "rules.json"
+	*toolName, *trufflehogPath, *cloneStrategy, *cacheDir, *linguistFiles = "thog", filepath.Join(dir, "trufflehog"), "full", "", "scan"
+	*threads, *cloneThreads, *scanThreads, *cloneRetries = 3, 0, 0, 0
+	*keepClones, *progressInterval = true, 0
+	scanCheckpoint, clonesDisk = nil, nil
+	collected = &findingsCollector{suppressed: make(map[string]int), repos: make(map[repoID]bool)}
+	failures = &failureLedger{}
+	makeDirectories()
+	return &testScan{t: t, dir: dir}, restore
+}
+
+// source creates a local repo with one commit and returns its clone URL
+func (s *testScan) source(name string) string {
+	path := filepath.Join(s.dir, "sources", name)
+	for _, args := range [][]string{
+		{"init", "-q", path},
+		{"-C", path, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", "first"},
+	} {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			s.t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	return "file://" + path
+}
+
+// scanned lists the names of the repos truffleHog scanned, in order
+func (s *testScan) scanned() []string {
+	content, _ := ioutil.ReadFile(filepath.Join(s.dir, "scans.log"))
+	var names []string
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		if line != "" {
+			names = append(names, filepath.Base(line))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Every repo is cloned and scanned once, however many times it is listed, and a repo that can't
+// be cloned does not keep the others from being scanned
+func TestPipelineScansEveryRepoOnce(t *testing.T) {
+	s, restore := newTestScan(t)
+	defer restore()
+
+	p := newPipeline()
+	var want []string
+	for _, name := range []string{"api", "web", "docs", "infra", "tools"} {
+		url := s.source(name)
+		want = append(want, name)
+		// The repo of the org the team has access to too
+		p.add(repoJob{URL: url, ID: newRepoID("acme", repoKind, name)})
+		p.add(repoJob{URL: url, ID: newRepoID("acme", repoKind, name)})
+	}
+	p.add(repoJob{URL: "file://" + filepath.Join(s.dir, "sources", "missing"), ID: newRepoID("acme", repoKind, "missing")})
+	p.addCloned(repoJob{ID: newRepoID("acme", repoKind, "api")})
+	p.wait()
+
+	sort.Strings(want)
+	if got := s.scanned(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("scanned %v, want %v", got, want)
+	}
+	if p.status.enumerated != 6 || p.status.done != 6 || p.status.scanned != 5 {
+		t.Errorf("progress: %d listed, %d done, %d scanned", p.status.enumerated, p.status.done, p.status.scanned)
+	}
+	if count := collected.count(); count != 5 {
+		t.Errorf("%d findings were collected, want 5", count)
+	}
+	entries := failures.entries()
+	if len(entries) != 1 || entries[0].Repo != "missing" || entries[0].Stage != "clone" {
+		t.Errorf("failures = %+v, want the clone of missing", entries)
+	}
+}
+
+// Without keepClones, the working copies are deleted and the saved findings are reported
+func TestPipelineDeletesClones(t *testing.T) {
+	s, restore := newTestScan(t)
+	defer restore()
+	*keepClones = false
+	clonesDisk = newDiskBudget(1 << 30)
+
+	p := newPipeline()
+	for _, name := range []string{"api", "web"} {
+		p.add(repoJob{URL: s.source(name), ID: newRepoID("acme", repoKind, name)})
+	}
+	p.wait()
+
+	for _, name := range []string{"api", "web"} {
+		id := newRepoID("acme", repoKind, name)
+		if fileExists(cloneDir(id)) {
+			t.Errorf("the clone of %s was kept", name)
+		}
+		if !fileExists(resultPath(id, savedFindingsFile)) {
+			t.Errorf("the findings of %s were not saved", name)
+		}
+	}
+	if clonesDisk.used != 0 || clonesDisk.pending != 0 {
+		t.Errorf("the disk budget still has %d bytes used by %d repos", clonesDisk.used, clonesDisk.pending)
+	}
+
+	// A later report reads the saved findings back
+	collected = &findingsCollector{suppressed: make(map[string]int), repos: make(map[repoID]bool)}
+	findings, _ := collected.report()
+	if len(findings) != 2 || findings[0].Secret != "AKIAapi" {
+		t.Errorf("reported %+v", findings)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// progress counts the repos going through the pipeline and shows how far the scan got. On a
+// terminal, a status line is kept below the output and refreshed every second. Otherwise, a
+// summary is printed every progressInterval.
+type progress struct {
+	mutex   sync.Mutex
+	started time.Time
+	// listed is set once every repo was listed, until then more repos can show up
+	listed     bool
+	enumerated int
+	cloned     int
+	scanned    int
+	// done is the number of repos that left the pipeline, whether they were scanned or not
+	done  int
+	bytes int64
+	// failuresBefore is the size of the failure ledger when the pipeline started
+	failuresBefore int
+
+	// terminal is set when the status line is kept below the output
+	terminal bool
+	stop     chan struct{}
+	stopped  chan struct{}
+}
+
+// console is the standard output of the scan. Everything is printed through it, from the
+// goroutines of the pipeline too, so that the lines and the status line of the progress are
+// written one at a time.
+var console = &consoleWriter{out: os.Stdout}
+
+type consoleWriter struct {
+	mutex sync.Mutex
+	out   io.Writer
+	// status is the line drawn below the output, if any
+	status func() string
+	// midLine is set while the last write did not end its line, which must not be cleared
+	midLine bool
+}
+
+// Write clears the status line, writes the output and draws the status line again below it
+func (c *consoleWriter) Write(b []byte) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.status == nil {
+		return c.out.Write(b)
+	}
+
+	if !c.midLine {
+		io.WriteString(c.out, "\r\x1b[K")
+	}
+	n, err := c.out.Write(b)
+	c.midLine = len(b) > 0 && b[len(b)-1] != '\n'
+	if !c.midLine {
+		io.WriteString(c.out, c.status())
+	}
+	return n, err
+}
+
+// showStatus draws the status line again, or stops drawing it when status is nil
+func (c *consoleWriter) showStatus(status func() string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.status != nil && !c.midLine {
+		io.WriteString(c.out, "\r\x1b[K")
+	}
+	c.status = status
+	if c.status != nil && !c.midLine {
+		io.WriteString(c.out, c.status())
+	}
+}
+
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// startProgress starts reporting the progress, unless the progress flag is 0
+func startProgress() *progress {
+	p := &progress{started: time.Now(), failuresBefore: failures.count()}
+	if *progressInterval <= 0 {
+		return p
+	}
+
+	interval := *progressInterval
+	if isTerminal(os.Stdout) {
+		p.terminal = true
+		log.SetOutput(console)
+		interval = time.Second
+	}
+
+	p.stop = make(chan struct{})
+	p.stopped = make(chan struct{})
+	go func() {
+		defer close(p.stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.show()
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// finish stops the reporting and prints the last summary
+func (p *progress) finish() {
+	if p.stop == nil {
+		return
+	}
+	close(p.stop)
+	<-p.stopped
+
+	if p.terminal {
+		console.showStatus(nil)
+		log.SetOutput(os.Stderr)
+	}
+	fmt.Fprintln(console, p.lockedSummary())
+}
+
+func (p *progress) show() {
+	if p.terminal {
+		console.showStatus(p.lockedSummary)
+	} else {
+		fmt.Fprintln(console, p.lockedSummary())
+	}
+}
+
+func (p *progress) lockedSummary() string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.summary()
+}
+
+// summary is a line such as: Progress: 120+ repos listed, 80 cloned (1.2G), 75 scanned, 2 failed, 14 findings, ETA 25m0s
+func (p *progress) summary() string {
+	enumerated := strconv.Itoa(p.enumerated)
+	if !p.listed {
+		enumerated += "+"
+	}
+	failed := failures.count() - p.failuresBefore
+
+	return "Progress: " + enumerated + " repos listed, " +
+		strconv.Itoa(p.cloned) + " cloned (" + formatSize(p.bytes) + "), " +
+		strconv.Itoa(p.scanned) + " scanned, " +
+		strconv.Itoa(failed) + " failed, " +
+		strconv.Itoa(collected.count()) + " findings, ETA " + p.eta()
+}
+
+// eta assumes the remaining repos take as long as the ones that left the pipeline so far. It
+// grows while repos are still being listed.
+func (p *progress) eta() string {
+	if p.done == 0 {
+		return "unknown"
+	}
+	if p.done >= p.enumerated {
+		if p.listed {
+			return "done"
+		}
+		return "unknown"
+	}
+	perRepo := time.Since(p.started) / time.Duration(p.done)
+	return (perRepo * time.Duration(p.enumerated-p.done)).Round(time.Second).String()
+}
+
+func (p *progress) enumerate() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.enumerated++
+}
+
+func (p *progress) allListed() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.listed = true
+}
+
+func (p *progress) clone(size int64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.cloned++
+	p.bytes += size
+}
+
+func (p *progress) scan() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.scanned++
+}
+
+func (p *progress) leave() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.done++
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// The lines printed by concurrent goroutines are written whole, each followed by the status line
+func TestConsoleWriterStatusLine(t *testing.T) {
+	var out bytes.Buffer
+	c := &consoleWriter{out: &out}
+	c.showStatus(func() string { return "Progress" })
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				fmt.Fprintln(c, "repo", i, j)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	chunks := strings.Split(out.String(), "\r\x1b[K")
+	if chunks[0] != "Progress" {
+		t.Fatalf("the status line was not drawn first: %q", chunks[0])
+	}
+	lines := make(map[string]bool)
+	for _, chunk := range chunks[1:] {
+		if !strings.HasSuffix(chunk, "\nProgress") || strings.Count(chunk, "\n") != 1 {
+			t.Fatalf("garbled output %q", chunk)
+		}
+		lines[strings.TrimSuffix(chunk, "\nProgress")] = true
+	}
+	if len(lines) != 500 {
+		t.Errorf("%d distinct lines were written, want 500", len(lines))
+	}
+
+	// A line written in several parts is not cleared halfway, and the status line is removed in the end
+	out.Reset()
+	fmt.Fprint(c, "Cloning ")
+	c.showStatus(func() string { return "Progress" })
+	fmt.Fprint(c, "acme/api\n")
+	c.showStatus(nil)
+	fmt.Fprintln(c, "done")
+	if got, want := out.String(), "\r\x1b[KCloning acme/api\nProgress\r\x1b[Kdone\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// Wait before retrying after a secondary rate limit without a Retry-After header, doubled
+	// every time the limit is hit again up to maxRateLimitBackoff
+	secondaryRateLimitBackoff = time.Minute
+	maxRateLimitBackoff       = 15 * time.Minute
+	// Rate limited attempts after which a request fails, so that it ends up in the failure
+	// ledger instead of stalling the scan
+	rateLimitAttempts = 10
+)
+
+// rateLimiter holds back the requests to the Github API until a rate limit is over, so that
+// they don't keep hitting the limit in the meantime
+type rateLimiter struct {
+	mutex    sync.Mutex
+	resumeAt time.Time
+}
+
+var githubRateLimit = &rateLimiter{}
+
+// rateLimitTransport waits out the primary and secondary rate limits of the Github API and
+// sends the request again, instead of failing the listing it is part of
+type rateLimitTransport struct {
+	base    http.RoundTripper
+	limiter *rateLimiter
+}
+
+func newRateLimitTransport(base http.RoundTripper) *rateLimitTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &rateLimitTransport{base: base, limiter: githubRateLimit}
+}
+
+// primaryRateLimited is a response to a request rejected because the token has no requests left
+func primaryRateLimited(resp *http.Response) bool {
+	return (resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests) &&
+		resp.Header.Get("X-RateLimit-Remaining") == "0"
+}
+
+// rateLimitWait is how long to wait before sending a request again that got this response,
+// or 0 if it was not rate limited
+func rateLimitWait(resp *http.Response, backoff time.Duration) (time.Duration, string) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, ""
+	}
+
+	if retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+		return time.Duration(retryAfter) * time.Second, "Github asked to retry after " + strconv.Itoa(retryAfter) + "s"
+	}
+
+	if primaryRateLimited(resp) {
+		reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+		if err != nil {
+			return backoff, "hit the rate limit"
+		}
+		wait := time.Until(time.Unix(reset, 0)) + time.Second
+		if wait < time.Second {
+			wait = time.Second
+		}
+		return wait, "hit the rate limit"
+	}
+
+	// The message is the only way to tell a secondary rate limit from a lack of permissions
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	message := strings.ToLower(string(body))
+	if strings.Contains(message, "secondary rate limit") || strings.Contains(message, "abuse") {
+		return backoff, "hit the secondary rate limit"
+	}
+	return 0, ""
+}
+
+// wait blocks until the requests can be sent again
+func (l *rateLimiter) wait(req *http.Request) error {
+	l.mutex.Lock()
+	wait := time.Until(l.resumeAt)
+	l.mutex.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+}
+
+func (l *rateLimiter) pause(wait time.Duration, reason string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	resumeAt := time.Now().Add(wait)
+	if resumeAt.After(l.resumeAt) {
+		l.resumeAt = resumeAt
+		Info("Github API: %s, waiting %s until %s before resuming", reason, wait.Round(time.Second), resumeAt.Format("15:04:05"))
+	}
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	backoff := secondaryRateLimitBackoff
+	for attempts := 1; ; attempts++ {
+		if err := t.limiter.wait(req); err != nil {
+			return nil, err
+		}
+
+		// a RoundTripper must not modify the request it is given
+		attempt := *req
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attempt.Body = body
+		}
+
+		resp, err := t.base.RoundTrip(&attempt)
+		if err != nil {
+			return nil, err
+		}
+
+		wait, reason := rateLimitWait(resp, backoff)
+		if wait == 0 || (req.Body != nil && req.GetBody == nil) {
+			hideRateLimit(resp)
+			return resp, nil
+		}
+		resp.Body.Close()
+		if attempts >= rateLimitAttempts {
+			return nil, fmt.Errorf("Github API: %s, giving up on %s after %d attempts", reason, req.URL.Path, attempts)
+		}
+
+		t.limiter.pause(wait, reason)
+		if resp.Header.Get("Retry-After") == "" && !primaryRateLimited(resp) {
+			backoff *= 2
+			if backoff > maxRateLimitBackoff {
+				backoff = maxRateLimitBackoff
+			}
+		}
+	}
+}
+
+// hideRateLimit removes the rate limit headers from a response handed to go-github. Once a
+// response reports that no requests are left until the reset, go-github refuses to send any
+// request until then, which would bypass the waiting above and the other tokens of the pool.
+// Without a reset, it does not record a rate limit at all.
+func hideRateLimit(resp *http.Response) {
+	resp.Header.Del("X-RateLimit-Remaining")
+	resp.Header.Del("X-RateLimit-Reset")
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// A listing is paged through the transport even when the responses report few requests left
+func TestRateLimitTransportPaging(t *testing.T) {
+	hits := 0
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+		page := r.URL.Query().Get("page")
+		if page == "" {
+			page = "1"
+		}
+		if page == "1" {
+			w.Header().Set("Link", fmt.Sprintf(`<%s%s?page=2>; rel="next"`, server.URL, r.URL.Path))
+		}
+		fmt.Fprintf(w, `[{"name": "repo%s"}]`, page)
+	}))
+	defer server.Close()
+
+	defer func(previous string) { *enterpriseURL = previous }(*enterpriseURL)
+	*enterpriseURL = server.URL + "/"
+	defer func(previous *tokenPool) { apiTokens = previous }(apiTokens)
+	apiTokens = nil
+
+	client, err := authenticatetogit(context.Background(), "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		repos, err := listRepos(context.Background(), client, "orgs/acme/repos", url.Values{})
+		if err != nil {
+			t.Fatalf("listing %d: %v", i+1, err)
+		}
+		if len(repos) != 2 || repos[0].GetName() != "repo1" || repos[1].GetName() != "repo2" {
+			t.Fatalf("listing %d: got %d repos", i+1, len(repos))
+		}
+	}
+	if hits != 4 {
+		t.Errorf("the server got %d requests, want 4", hits)
+	}
+}
+
+func TestRateLimitWait(t *testing.T) {
+	reset := strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10)
+	tests := []struct {
+		name    string
+		status  int
+		headers map[string]string
+		body    string
+		min     time.Duration
+		max     time.Duration
+	}{
+		{"ok", http.StatusOK, map[string]string{"X-RateLimit-Remaining": "0"}, "", 0, 0},
+		{"retry after", http.StatusForbidden, map[string]string{"Retry-After": "30"}, "", 30 * time.Second, 30 * time.Second},
+		{"primary", http.StatusForbidden, map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": reset}, "", 50 * time.Second, 62 * time.Second},
+		{"secondary", http.StatusForbidden, nil, `{"message": "You have exceeded a secondary rate limit"}`, time.Minute, time.Minute},
+		{"forbidden", http.StatusForbidden, nil, `{"message": "Resource not accessible"}`, 0, 0},
+	}
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		for name, value := range test.headers {
+			recorder.Header().Set(name, value)
+		}
+		recorder.WriteHeader(test.status)
+		recorder.WriteString(test.body)
+
+		wait, _ := rateLimitWait(recorder.Result(), time.Minute)
+		if wait < test.min || wait > test.max {
+			t.Errorf("%s: waiting %s, want between %s and %s", test.name, wait, test.min, test.max)
+		}
+	}
+}
+
+// The backoff of the secondary rate limit is capped and the request fails after rateLimitAttempts
+func TestRateLimitTransportGivesUp(t *testing.T) {
+	defer func(backoff, max time.Duration, attempts int) {
+		secondaryRateLimitBackoff, maxRateLimitBackoff, rateLimitAttempts = backoff, max, attempts
+	}(secondaryRateLimitBackoff, maxRateLimitBackoff, rateLimitAttempts)
+	secondaryRateLimitBackoff, maxRateLimitBackoff, rateLimitAttempts = 10*time.Millisecond, 40*time.Millisecond, 7
+
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"message": "You have exceeded a secondary rate limit"}`)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &rateLimitTransport{base: http.DefaultTransport, limiter: &rateLimiter{}}}
+	start := time.Now()
+	_, err := client.Get(server.URL + "/orgs/acme/repos")
+	elapsed := time.Since(start)
+	if err == nil {
+		t.Fatal("the request did not fail")
+	}
+	if hits != rateLimitAttempts {
+		t.Errorf("the request was sent %d times, want %d", hits, rateLimitAttempts)
+	}
+	// 10+20+40+40+40+40ms with the cap, 630ms without it
+	if elapsed < 190*time.Millisecond || elapsed > 400*time.Millisecond {
+		t.Errorf("the request gave up after %s, want about 190ms", elapsed)
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// repoPattern matches repositories by exact name, by owner/name, by glob or, when
+// written between slashes, by regular expression. Patterns with a slash (other than
+// regular expressions) are matched against owner/name, the others against the name.
+type repoPattern struct {
+	pattern string
+	regex   *regexp.Regexp
+}
+
+type repoFilter struct {
+	includes []repoPattern
+	excludes []repoPattern
+}
+
+// repoFilters is built from the includeRepos, excludeRepos and blacklist flags
+var repoFilters = &repoFilter{}
+
+func newRepoPattern(pattern string) (repoPattern, error) {
+	if len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		regex, err := regexp.Compile("(?i)" + pattern[1:len(pattern)-1])
+		if err != nil {
+			return repoPattern{}, fmt.Errorf("invalid repo pattern %s: %v", pattern, err)
+		}
+		return repoPattern{pattern: pattern, regex: regex}, nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return repoPattern{}, fmt.Errorf("invalid repo pattern %s: %v", pattern, err)
+	}
+	return repoPattern{pattern: strings.ToLower(pattern)}, nil
+}
+
+func (p repoPattern) match(owner string, name string) bool {
+	fullName := owner + "/" + name
+	if p.regex != nil {
+		return p.regex.MatchString(name) || p.regex.MatchString(fullName)
+	}
+
+	subject := strings.ToLower(name)
+	if strings.Contains(p.pattern, "/") {
+		subject = strings.ToLower(fullName)
+	}
+	matched, _ := path.Match(p.pattern, subject)
+	return matched
+}
+
+// readRepoPatterns splits a comma separated list of patterns. An element starting with @
+// is a file that lists one pattern per line.
+func readRepoPatterns(list string) ([]repoPattern, error) {
+	var patterns []repoPattern
+
+	for _, element := range strings.Split(list, ",") {
+		element = strings.TrimSpace(element)
+		var lines []string
+
+		if strings.HasPrefix(element, "@") {
+			file, err := os.Open(element[1:])
+			if err != nil {
+				return nil, err
+			}
+			scanner := bufio.NewScanner(file)
+			for scanner.Scan() {
+				line := strings.TrimSpace(scanner.Text())
+				if line != "" && !strings.HasPrefix(line, "#") {
+					lines = append(lines, line)
+				}
+			}
+			file.Close()
+			if err := scanner.Err(); err != nil {
+				return nil, err
+			}
+		} else if element != "" {
+			lines = append(lines, element)
+		}
+
+		for _, line := range lines {
+			pattern, err := newRepoPattern(line)
+			if err != nil {
+				return nil, err
+			}
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns, nil
+}
+
+func newRepoFilter(includes string, excludes string, blacklist string) (*repoFilter, error) {
+	var err error
+	filter := &repoFilter{}
+
+	filter.includes, err = readRepoPatterns(includes)
+	if err != nil {
+		return nil, err
+	}
+	filter.excludes, err = readRepoPatterns(excludes)
+	if err != nil {
+		return nil, err
+	}
+
+	// The blacklist only ever meant exact repo names
+	for _, name := range strings.Split(blacklist, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			filter.excludes = append(filter.excludes, repoPattern{pattern: strings.ToLower(escapeGlob(name))})
+		}
+	}
+	return filter, nil
+}
+
+func escapeGlob(name string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`)
+	return replacer.Replace(name)
+}
+
+// allowed reports whether the repository of this owner should be cloned and scanned
+func (filter *repoFilter) allowed(owner string, name string) bool {
+	included := len(filter.includes) == 0
+	for _, p := range filter.includes {
+		if p.match(owner, name) {
+			included = true
+			break
+		}
+	}
+	for _, p := range filter.excludes {
+		if p.match(owner, name) {
+			return false
+		}
+	}
+	return included
+}
+
+// skipRepo prints why a repository is not cloned, if it isn't
+func skipRepo(owner string, name string) bool {
+	if repoFilters.allowed(owner, name) {
+		return false
+	}
+	fmt.Fprintln(console, "Repo "+owner+"/"+name+" is excluded by the includeRepos, excludeRepos or blacklist flags, moving on..")
+	return true
+}
+
+// metadataFilter selects repositories by their Github metadata, before anything is cloned
+type metadataFilter struct {
+	archived     string
+	skipDisabled bool
+	visibility   []string
+	languages    []string
+	topics       []string
+	minSize      int
+	maxSize      int
+	pushedAfter  time.Time
+}
+
+var repoMetadata = &metadataFilter{archived: "include", skipDisabled: true}
+
+// parsePushedAfter takes a date, a timestamp or a duration back from now such as 24h or 7d
+func parsePushedAfter(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err == nil {
+			return time.Now().AddDate(0, 0, -days), nil
+		}
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid pushedAfter %s, it should be a date like 2019-01-31 or a duration like 7d", value)
+	}
+	return time.Now().Add(-d), nil
+}
+
+func splitLower(list string) []string {
+	var result []string
+	for _, element := range strings.Split(list, ",") {
+		if element = strings.ToLower(strings.TrimSpace(element)); element != "" {
+			result = append(result, element)
+		}
+	}
+	return result
+}
+
+func newMetadataFilter(archived string, skipDisabled bool, visibility string, languages string, topics string, minSize int, maxSize int, pushedAfter string) (*metadataFilter, error) {
+	if !(archived == "include" || archived == "exclude" || archived == "only") {
+		return nil, fmt.Errorf("archived should be either include, exclude or only")
+	}
+	for _, v := range splitLower(visibility) {
+		if !(v == "public" || v == "private" || v == "internal") {
+			return nil, fmt.Errorf("visibility should be a comma separated list of public, private and internal")
+		}
+	}
+	after, err := parsePushedAfter(pushedAfter)
+	if err != nil {
+		return nil, err
+	}
+
+	return &metadataFilter{
+		archived:     archived,
+		skipDisabled: skipDisabled,
+		visibility:   splitLower(visibility),
+		languages:    splitLower(languages),
+		topics:       splitLower(topics),
+		minSize:      minSize,
+		maxSize:      maxSize,
+		pushedAfter:  after,
+	}, nil
+}
+
+func containsLower(list []string, value string) bool {
+	for _, element := range list {
+		if element == strings.ToLower(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (repo *repository) visibility() string {
+	if repo.Visibility != nil {
+		return *repo.Visibility
+	}
+	if repo.GetPrivate() {
+		return "private"
+	}
+	return "public"
+}
+
+// reject returns why the repository does not match the filter, or an empty string if it does
+func (filter *metadataFilter) reject(repo *repository) string {
+	archived := repo.GetArchived()
+	if filter.archived == "exclude" && archived {
+		return "it is archived"
+	} else if filter.archived == "only" && !archived {
+		return "it is not archived"
+	}
+	if filter.skipDisabled && repo.Disabled != nil && *repo.Disabled {
+		return "it is disabled"
+	}
+	if len(filter.visibility) > 0 && !containsLower(filter.visibility, repo.visibility()) {
+		return "it is " + repo.visibility()
+	}
+	if len(filter.languages) > 0 && !containsLower(filter.languages, repo.GetLanguage()) {
+		return "its language is " + repo.GetLanguage()
+	}
+	if len(filter.topics) > 0 {
+		found := false
+		for _, topic := range repo.Topics {
+			found = found || containsLower(filter.topics, topic)
+		}
+		if !found {
+			return "it has none of the topics"
+		}
+	}
+	if filter.minSize > 0 && repo.GetSize() < filter.minSize {
+		return "it is smaller than minSize"
+	}
+	if filter.maxSize > 0 && repo.GetSize() > filter.maxSize {
+		return "it is bigger than maxSize"
+	}
+	if !filter.pushedAfter.IsZero() && (repo.PushedAt == nil || repo.PushedAt.Before(filter.pushedAfter)) {
+		return "it was not pushed after " + filter.pushedAfter.Format("2006-01-02 15:04")
+	}
+	return ""
+}
+
+// selectRepos applies the repo patterns and the metadata filters right after listing
+func selectRepos(repos []*repository) []*repository {
+	var selected []*repository
+	for _, repo := range repos {
+		if skipRepo(repo.GetOwner().GetLogin(), repo.GetName()) {
+			continue
+		}
+		if reason := repoMetadata.reject(repo); reason != "" {
+			fmt.Fprintln(console, "Repo "+repo.GetFullName()+" is skipped because "+reason+", moving on..")
+			continue
+		}
+		selected = append(selected, repo)
+	}
+	return selected
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewRepoPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		owner   string
+		name    string
+		matched bool
+	}{
+		{"api", "acme", "api", true},
+		{"api", "acme", "api-gateway", false},
+		{"API", "acme", "api", true},
+		{"api-*", "acme", "api-gateway", true},
+		{"acme/api", "acme", "api", true},
+		{"acme/api", "other", "api", false},
+		{"*/api", "other", "api", true},
+		{"/^api-(dev|prod)$/", "acme", "api-prod", true},
+		{"/^api-(dev|prod)$/", "acme", "api-test", false},
+		{"/^acme/", "acme", "api", true},
+		{"/TEST/", "acme", "unit-test", true},
+	}
+	for _, test := range tests {
+		p, err := newRepoPattern(test.pattern)
+		if err != nil {
+			t.Errorf("newRepoPattern(%q): %v", test.pattern, err)
+			continue
+		}
+		if matched := p.match(test.owner, test.name); matched != test.matched {
+			t.Errorf("%q matching %s/%s = %v, want %v", test.pattern, test.owner, test.name, matched, test.matched)
+		}
+	}
+
+	for _, invalid := range []string{"/api(/", "api[", "[-]"} {
+		if _, err := newRepoPattern(invalid); err == nil {
+			t.Errorf("newRepoPattern(%q) did not fail", invalid)
+		}
+	}
+}
+
+func TestRepoFilterBlacklist(t *testing.T) {
+	filter, err := newRepoFilter("", "", "api*,docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		allowed bool
+	}{
+		{"api*", false},
+		{"api-gateway", true},
+		{"DOCS", false},
+	}
+	for _, test := range tests {
+		if allowed := filter.allowed("acme", test.name); allowed != test.allowed {
+			t.Errorf("allowed(%q) = %v, want %v", test.name, allowed, test.allowed)
+		}
+	}
+}
+
+func TestParsePushedAfter(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		value string
+		want  time.Time
+		fails bool
+	}{
+		{"", time.Time{}, false},
+		{"2019-01-31", time.Date(2019, 1, 31, 0, 0, 0, 0, time.UTC), false},
+		{"2019-01-31T10:00:00+02:00", time.Date(2019, 1, 31, 8, 0, 0, 0, time.UTC), false},
+		{"7d", now.AddDate(0, 0, -7), false},
+		{"24h", now.Add(-24 * time.Hour), false},
+		{"90m", now.Add(-90 * time.Minute), false},
+		{"last week", time.Time{}, true},
+		{"31/01/2019", time.Time{}, true},
+	}
+	for _, test := range tests {
+		got, err := parsePushedAfter(test.value)
+		if (err != nil) != test.fails {
+			t.Errorf("parsePushedAfter(%q) failed with %v", test.value, err)
+			continue
+		}
+		if diff := got.Sub(test.want); diff < -time.Minute || diff > time.Minute {
+			t.Errorf("parsePushedAfter(%q) = %s, want %s", test.value, got, test.want)
+		}
+	}
+}
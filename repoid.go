@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// Kinds of the sources that are cloned and scanned
+const (
+	repoKind = "repo"
+	gistKind = "gist"
+)
+
+// repoID identifies a repo or a gist by the Github host it is on, its owner, its kind and its
+// name. Clones and results are stored under <host>/<owner>/<kind>/<name>, so a gist can't take
+// the place of a repo with the same name, nor the repo of an org the one of a member.
+type repoID struct {
+	Host  string
+	Owner string
+	Kind  string
+	Name  string
+}
+
+// githubHost is the host of the Github instance being scanned
+func githubHost() string {
+	if *enterpriseURL != "" {
+		if u, err := url.Parse(*enterpriseURL); err == nil && u.Hostname() != "" {
+			return u.Hostname()
+		}
+	}
+	return "github.com"
+}
+
+func newRepoID(owner string, kind string, name string) repoID {
+	return repoID{Host: githubHost(), Owner: owner, Kind: kind, Name: name}
+}
+
+// idFromDir finds the repo cloned into dir, which is <reposDir>/<host>/<owner>/<kind>/<name>
+func idFromDir(dir string) (repoID, bool) {
+	rel, err := filepath.Rel(reposDir, dir)
+	if err != nil {
+		return repoID{}, false
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if len(parts) != 4 || parts[0] == ".." {
+		return repoID{}, false
+	}
+	return repoID{Host: parts[0], Owner: parts[1], Kind: parts[2], Name: parts[3]}, true
+}
+
+func (id repoID) path() string {
+	return filepath.Join(id.Host, id.Owner, id.Kind, id.Name)
+}
+
+// String is how the repo is shown in the logs and the reports, for instance github.com/org/repo
+// or github.com/user/gist/<id>
+func (id repoID) String() string {
+	if id.Kind == repoKind {
+		return id.Host + "/" + id.Owner + "/" + id.Name
+	}
+	return id.Host + "/" + id.Owner + "/" + id.Kind + "/" + id.Name
+}
+
+// less orders the repos by host, owner, kind and name
+func (id repoID) less(other repoID) bool {
+	if id.Host != other.Host {
+		return id.Host < other.Host
+	}
+	if id.Owner != other.Owner {
+		return id.Owner < other.Owner
+	}
+	if id.Kind != other.Kind {
+		return id.Kind < other.Kind
+	}
+	return id.Name < other.Name
+}
+
+// cloneDir is the directory the repository is cloned into
+func cloneDir(id repoID) string {
+	return filepath.Join(reposDir, id.path())
+}
+
+// repoPath is the directory the repository was cloned into, or an empty string if it was not
+// cloned or its clone was deleted
+func repoPath(id repoID) string {
+	if dir := cloneDir(id); fileExists(dir) {
+		return dir
+	}
+	return ""
+}
+
+// resultDir is the directory the tools write the results of the repo into
+func resultDir(id repoID) string {
+	return filepath.Join(resultsDir, id.path())
+}
+
+// resultPath is the file the tool writes the results of the repo into
+func resultPath(id repoID, toolname string) string {
+	return filepath.Join(resultDir(id), toolname)
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"html/template"
+	"os"
+	"sort"
+	"time"
+)
+
+type reportCount struct {
+	Name  string
+	Count int
+}
+
+type reportRepo struct {
+	Name             string
+	Kind             string
+	URL              string
+	TruncatedHistory string
+	Findings         []finding
+}
+
+type reportOwner struct {
+	Name  string
+	Repos []*reportRepo
+}
+
+type htmlReport struct {
+	Generated  string
+	Incomplete bool
+	Total      int
+	Repos      int
+	Severities []reportCount
+	Tools      []reportCount
+	Rules      []reportCount
+	Suppressed []reportCount
+	Failures   []ledgerEntry
+	Owners     []*reportOwner
+}
+
+// countBy counts the findings per key and returns them in the given order,
+// followed by any other key sorted by name
+func countBy(findings []finding, key func(finding) string, order []string) []reportCount {
+	counts := make(map[string]int)
+	for _, f := range findings {
+		counts[key(f)]++
+	}
+
+	var result []reportCount
+	for _, name := range order {
+		if count, ok := counts[name]; ok {
+			result = append(result, reportCount{Name: name, Count: count})
+			delete(counts, name)
+		}
+	}
+	var rest []string
+	for name := range counts {
+		rest = append(rest, name)
+	}
+	sort.Strings(rest)
+	for _, name := range rest {
+		result = append(result, reportCount{Name: name, Count: counts[name]})
+	}
+	return result
+}
+
+// newHTMLReport groups the findings by host and org/user, then by repo or gist, same as the
+// <host>/<orgoruser>/<kind>/<name> layout of the results
+func newHTMLReport(findings []finding, suppressed map[string]int, failed []ledgerEntry, incomplete bool) *htmlReport {
+	report := &htmlReport{
+		Generated:  time.Now().Format(time.RFC1123),
+		Incomplete: incomplete,
+		Total:      len(findings),
+		Severities: countBy(findings, func(f finding) string { return f.Severity }, []string{"critical", "high", "medium", "low"}),
+		Tools:      countBy(findings, func(f finding) string { return f.Tool }, nil),
+		Rules:      countBy(findings, func(f finding) string { return f.Rule }, nil),
+		Failures:   failed,
+	}
+
+	for _, reason := range sortedKeys(suppressed) {
+		if suppressed[reason] > 0 {
+			report.Suppressed = append(report.Suppressed, reportCount{Name: reason, Count: suppressed[reason]})
+		}
+	}
+
+	owners := make(map[string]*reportOwner)
+	repos := make(map[repoID]*reportRepo)
+	for _, f := range findings {
+		owner, ok := owners[f.Host+"/"+f.OrgOrUser]
+		if !ok {
+			owner = &reportOwner{Name: f.Host + "/" + f.OrgOrUser}
+			owners[f.Host+"/"+f.OrgOrUser] = owner
+			report.Owners = append(report.Owners, owner)
+		}
+		repo, ok := repos[f.id()]
+		if !ok {
+			repo = &reportRepo{Name: f.Repo, Kind: f.Kind, URL: f.RepoURL, TruncatedHistory: f.TruncatedHistory}
+			repos[f.id()] = repo
+			owner.Repos = append(owner.Repos, repo)
+			report.Repos++
+		}
+		repo.Findings = append(repo.Findings, f)
+	}
+	return report
+}
+
+func sortedKeys(m map[string]int) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func writeHTMLReport(findings []finding, suppressed map[string]int, failed []ledgerEntry, incomplete bool, outputfile string) error {
+	of, err := os.Create(outputfile)
+	if err != nil {
+		return err
+	}
+	defer of.Close()
+
+	return reportTemplate.Execute(of, newHTMLReport(findings, suppressed, failed, incomplete))
+}
+
+// The report is a single file that can be opened offline so everything,
+// including the styles and the filtering script, is inlined.
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>git-all-secrets report</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #24292e; }
+h1 { font-size: 1.6em; }
+h2 { font-size: 1.3em; border-bottom: 1px solid #e1e4e8; padding-bottom: .3em; }
+h3 { font-size: 1.1em; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 1.5em; }
+th, td { border: 1px solid #e1e4e8; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f6f8fa; }
+.summary td, .summary th { width: auto; }
+.summary { width: auto; display: inline-table; margin-right: 2em; }
+.sev { font-weight: bold; text-transform: uppercase; font-size: .8em; }
+.sev-critical { color: #b31d28; }
+.sev-high { color: #d15704; }
+.sev-medium { color: #b08800; }
+.sev-low { color: #586069; }
+code { word-break: break-all; }
+pre { max-height: 300px; overflow: auto; background: #f6f8fa; padding: 8px; }
+.filters { margin: 1em 0; padding: 1em; background: #f6f8fa; }
+.filters label { margin-right: 1.5em; }
+.truncated { color: #b08800; }
+.incomplete { color: #b31d28; font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>git-all-secrets report</h1>
+<p>Generated {{.Generated}}. {{.Total}} findings in {{.Repos}} repositories.</p>
+{{if .Incomplete}}<p class="incomplete">Incomplete report: the scan was interrupted. The repositories that were not cloned or scanned are listed in the failures below.</p>
+{{end}}
+<table class="summary">
+<tr><th>Severity</th><th>Findings</th></tr>
+{{range .Severities}}<tr><td class="sev sev-{{.Name}}">{{.Name}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>
+<table class="summary">
+<tr><th>Tool</th><th>Findings</th></tr>
+{{range .Tools}}<tr><td>{{.Name}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>
+<table class="summary">
+<tr><th>Rule</th><th>Findings</th></tr>
+{{range .Rules}}<tr><td>{{.Name}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>
+{{if .Suppressed}}<table class="summary">
+<tr><th>Suppressed by</th><th>Findings</th></tr>
+{{range .Suppressed}}<tr><td>{{.Name}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>
+{{end}}
+{{if .Failures}}<h2>Failures</h2>
+<p class="truncated">The secrets of these repositories are missing from this report because they could not be listed, cloned, scanned or read.</p>
+<table>
+<tr><th>Org/User</th><th>Repository</th><th>Kind</th><th>Stage</th><th>Tool</th><th>Error</th></tr>
+{{range .Failures}}<tr><td>{{if .Host}}{{.Host}}/{{end}}{{.OrgOrUser}}</td><td>{{.Repo}}</td><td>{{.Kind}}</td><td>{{.Stage}}</td><td>{{.Tool}}</td><td><code>{{.Error}}</code></td></tr>
+{{end}}</table>
+{{end}}
+<div class="filters">
+<label>Rule <select id="filter-rule"><option value="">All</option>{{range .Rules}}<option>{{.Name}}</option>{{end}}</select></label>
+<label>Tool <select id="filter-tool"><option value="">All</option>{{range .Tools}}<option>{{.Name}}</option>{{end}}</select></label>
+<label>Severity <select id="filter-severity"><option value="">All</option>{{range .Severities}}<option>{{.Name}}</option>{{end}}</select></label>
+<span id="filter-count"></span>
+</div>
+
+{{range .Owners}}<div class="owner">
+<h2>{{.Name}}</h2>
+{{range .Repos}}<div class="repo">
+<h3>{{.Name}}{{if eq .Kind "gist"}} <small>gist</small>{{end}}{{if .URL}} <small>{{.URL}}</small>{{end}}</h3>
+{{if .TruncatedHistory}}<p class="truncated">History truncated: {{.TruncatedHistory}}.</p>
+{{end}}<table>
+<tr><th>Severity</th><th>Rule</th><th>Tool</th><th>Path</th><th>Commit</th><th>Secret</th></tr>
+{{range .Findings}}<tr class="finding" data-rule="{{.Rule}}" data-tool="{{.Tool}}" data-severity="{{.Severity}}">
+<td class="sev sev-{{.Severity}}">{{.Severity}}</td>
+<td>{{.Rule}}</td>
+<td>{{.Tool}}</td>
+<td><code>{{.Path}}</code></td>
+<td>{{if .Hash}}<code>{{.Hash}}</code><br>{{.Branch}}<br>{{.Date}}<br>{{.Commit}}{{end}}</td>
+<td><code>{{.Secret}}</code><br><small>Fingerprint <code>{{.Fingerprint}}</code></small>{{if .Diff}}<details><summary>diff</summary><pre>{{.Diff}}</pre></details>{{end}}</td>
+</tr>
+{{end}}</table>
+</div>
+{{end}}</div>
+{{else}}<p>No secrets were found.</p>
+{{end}}
+
+<script>
+(function() {
+  var selects = ["rule", "tool", "severity"].map(function(name) {
+    return document.getElementById("filter-" + name);
+  });
+
+  function apply() {
+    var visible = 0;
+    var rows = document.querySelectorAll("tr.finding");
+    for (var i = 0; i < rows.length; i++) {
+      var show = selects.every(function(s) {
+        var name = s.id.replace("filter-", "");
+        return s.value === "" || rows[i].getAttribute("data-" + name) === s.value;
+      });
+      rows[i].style.display = show ? "" : "none";
+      if (show) { visible++; }
+    }
+    ["repo", "owner"].forEach(function(cls) {
+      var groups = document.querySelectorAll("div." + cls);
+      for (var i = 0; i < groups.length; i++) {
+        var shown = Array.prototype.some.call(groups[i].querySelectorAll("tr.finding"), function(r) {
+          return r.style.display !== "none";
+        });
+        groups[i].style.display = shown ? "" : "none";
+      }
+    });
+    document.getElementById("filter-count").textContent = visible + " of " + rows.length + " findings shown";
+  }
+
+  selects.forEach(function(s) { s.addEventListener("change", apply); });
+  apply();
+})();
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// The report groups the findings by host and owner, then by repo or gist, and escapes what the
+// repos control
+func TestHTMLReport(t *testing.T) {
+	findings := []finding{
+		{Host: "github.com", OrgOrUser: "acme", Kind: repoKind, Repo: "api", Tool: "truffleHog", Rule: "AWS API Key", Severity: "critical", Path: "config.yml", Secret: "AKIA"},
+		{Host: "github.com", OrgOrUser: "acme", Kind: repoKind, Repo: "api", Tool: "truffleHog", Rule: "Slack Token", Severity: "high", Path: "bot.js", Secret: "xoxb-<script>alert(1)</script>"},
+		{Host: "github.com", OrgOrUser: "jdoe", Kind: gistKind, Repo: "0123abcd", Tool: "repo-supervisor", Rule: entropyRule, Severity: "low", Path: "notes.md", Secret: "c2VjcmV0"},
+		{Host: "github.example.com", OrgOrUser: "acme", Kind: repoKind, Repo: "api", Tool: "truffleHog", Rule: "AWS API Key", Severity: "critical", Path: "config.yml", Secret: "AKIB"},
+	}
+	failed := []ledgerEntry{{Host: "github.com", OrgOrUser: "acme", Kind: repoKind, Repo: "web", Stage: "clone", Error: "not found"}}
+
+	report := newHTMLReport(findings, map[string]int{"baseline": 2, ignoreFileName: 0}, failed, true)
+	if report.Total != 4 || report.Repos != 3 || len(report.Owners) != 3 {
+		t.Fatalf("%d findings in %d repos of %d owners", report.Total, report.Repos, len(report.Owners))
+	}
+	if owner := report.Owners[0]; owner.Name != "github.com/acme" || len(owner.Repos) != 1 || len(owner.Repos[0].Findings) != 2 {
+		t.Errorf("the first owner is %s with %d repos", owner.Name, len(owner.Repos))
+	}
+	if report.Severities[0].Name != "critical" || report.Severities[0].Count != 2 {
+		t.Errorf("severities = %+v", report.Severities)
+	}
+	if len(report.Suppressed) != 1 || report.Suppressed[0].Name != "baseline" {
+		t.Errorf("suppressed = %+v", report.Suppressed)
+	}
+
+	file, err := ioutil.TempFile("", "git-all-secrets-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+	if err := writeHTMLReport(findings, nil, failed, true, file.Name()); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := ioutil.ReadFile(file.Name())
+	html := string(content)
+	for _, want := range []string{"Incomplete report", "<h2>github.example.com/acme</h2>", "<small>gist</small>", "not found", "xoxb-&lt;script&gt;"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("the report does not contain %q", want)
+		}
+	}
+	if strings.Contains(html, "<script>alert(1)") {
+		t.Error("a secret was not escaped")
+	}
+
+	if err := writeHTMLReport(nil, nil, nil, false, file.Name()); err != nil {
+		t.Fatal(err)
+	}
+	content, _ = ioutil.ReadFile(file.Name())
+	if !strings.Contains(string(content), "No secrets were found") || strings.Contains(string(content), "Incomplete report") {
+		t.Error("the empty report is wrong")
+	}
+}
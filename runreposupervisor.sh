@@ -1,5 +1,8 @@
 #!/bin/sh
 
-JSON_OUTPUT=1 node /root/repo-supervisor/dist/cli.js $1 | jq '.' > $2
+# repo-supervisor is installed next to this script, unless REPO_SUPERVISOR_HOME says otherwise
+REPO_SUPERVISOR_HOME=${REPO_SUPERVISOR_HOME:-$(dirname "$0")}
+
+JSON_OUTPUT=1 node "$REPO_SUPERVISOR_HOME/dist/cli.js" "$1" | jq '.' > "$2"
 
 exit 0
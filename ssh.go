@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// sshAgentEnv points git to the ssh-agent started for a passphrase protected key
+var sshAgentEnv []string
+
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// sshCommand is the GIT_SSH_COMMAND of every git process. Host keys are always verified
+// against the known_hosts file.
+func sshCommand() string {
+	args := []string{
+		"ssh",
+		"-o", "BatchMode=yes",
+		"-o", "StrictHostKeyChecking=yes",
+		"-o", "UserKnownHostsFile=" + shellQuote(*knownHosts),
+	}
+	if !*sshAgent {
+		args = append(args, "-o", "IdentitiesOnly=yes", "-i", shellQuote(*sshKey))
+	}
+	return strings.Join(args, " ")
+}
+
+func sshPassphrase() (string, error) {
+	if *sshPassphraseFile != "" {
+		content, err := ioutil.ReadFile(*sshPassphraseFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(content), "\r\n"), nil
+	}
+	return os.Getenv(*sshPassphraseEnv), nil
+}
+
+// writeScript writes an executable helper script to a temporary file
+func writeScript(name string, content string) (string, error) {
+	file, err := ioutil.TempFile("", name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if _, err := file.WriteString(content); err != nil {
+		return "", err
+	}
+	return file.Name(), file.Chmod(0700)
+}
+
+// setupSSH starts a private ssh-agent and adds the key to it when the key has a passphrase,
+// so that git never has to prompt for it. The returned function stops the agent.
+func setupSSH() (func(), error) {
+	if *sshPassphraseEnv == "" && *sshPassphraseFile == "" {
+		return func() {}, nil
+	}
+
+	passphrase, err := sshPassphrase()
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := exec.Command("ssh-agent", "-s").Output()
+	if err != nil {
+		return nil, fmt.Errorf("could not start ssh-agent: %v", err)
+	}
+	// SSH_AUTH_SOCK=/tmp/ssh-XXX/agent.1; export SSH_AUTH_SOCK;
+	for _, line := range strings.Split(string(out), "\n") {
+		assignment := strings.SplitN(line, ";", 2)[0]
+		if strings.HasPrefix(assignment, "SSH_AUTH_SOCK=") || strings.HasPrefix(assignment, "SSH_AGENT_PID=") {
+			sshAgentEnv = append(sshAgentEnv, assignment)
+		}
+	}
+
+	// ssh-add reads the passphrase from SSH_ASKPASS when it is not attached to a terminal
+	askpass, err := writeScript("git-all-secrets-ssh-askpass", "#!/bin/sh\necho \"$GAS_SSH_PASSPHRASE\"\n")
+	if err != nil {
+		stopSSHAgent()
+		return nil, err
+	}
+	defer os.Remove(askpass)
+
+	cmd := exec.Command("ssh-add", *sshKey)
+	cmd.Env = append(append(os.Environ(), sshAgentEnv...),
+		"SSH_ASKPASS="+askpass,
+		"SSH_ASKPASS_REQUIRE=force",
+		"DISPLAY=none",
+		"GAS_SSH_PASSPHRASE="+passphrase,
+	)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		stopSSHAgent()
+		return nil, fmt.Errorf("could not add %s to ssh-agent: %v: %s", *sshKey, err, out)
+	}
+
+	*sshAgent = true
+	return stopSSHAgent, nil
+}
+
+// stopSSHAgent stops the ssh-agent holding the decrypted key, if one was started
+func stopSSHAgent() {
+	for _, assignment := range sshAgentEnv {
+		var agentPid int
+		if _, err := fmt.Sscanf(assignment, "SSH_AGENT_PID=%d", &agentPid); err == nil && agentPid > 0 {
+			syscall.Kill(agentPid, syscall.SIGTERM)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pooledToken is one of the tokens of the pool along with its quota as last reported by Github
+type pooledToken struct {
+	value     string
+	remaining int
+	reset     time.Time
+	known     bool
+	dropped   bool
+}
+
+// tokenPool spreads the API calls over several tokens, always picking the token with the most
+// remaining requests according to the rate limit headers of the responses. Tokens rejected with
+// a 401 are dropped for the rest of the run. The calls whose results depend on who the token
+// belongs to always use the first token left, so that all their pages are of the same user.
+type tokenPool struct {
+	mutex  sync.Mutex
+	tokens []*pooledToken
+	base   http.RoundTripper
+}
+
+// apiTokens is the pool of the tokens provided with the token flag
+var apiTokens *tokenPool
+
+func newTokenPool(tokens string) *tokenPool {
+	pool := &tokenPool{base: http.DefaultTransport}
+	seen := make(map[string]bool)
+	for _, t := range strings.Split(tokens, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		pool.tokens = append(pool.tokens, &pooledToken{value: t})
+	}
+	return pool
+}
+
+// maskToken only keeps the end of a token so that it can be logged
+func maskToken(token string) string {
+	if len(token) <= 4 {
+		return "****"
+	}
+	return "****" + token[len(token)-4:]
+}
+
+// quota is the number of requests the token has left. Tokens that were not used yet or whose
+// quota was reset since come first so that every token gets used.
+func (t *pooledToken) quota(now time.Time) int {
+	if !t.known || now.After(t.reset) {
+		return int(^uint(0) >> 1)
+	}
+	return t.remaining
+}
+
+func (p *tokenPool) pick() *pooledToken {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	now := time.Now()
+	var best *pooledToken
+	for _, t := range p.tokens {
+		if t.dropped {
+			continue
+		}
+		if best == nil || t.quota(now) > best.quota(now) {
+			best = t
+		}
+	}
+	return best
+}
+
+// update records the quota of the token from the rate limit headers of a response
+func (p *tokenPool) update(t *pooledToken, resp *http.Response) {
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	t.remaining = remaining
+	t.reset = time.Unix(reset, 0)
+	t.known = true
+}
+
+func (p *tokenPool) drop(t *pooledToken) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if !t.dropped {
+		t.dropped = true
+		Info("Dropping the token %s since Github rejected it as unauthorized\n", maskToken(t.value))
+	}
+}
+
+// pinned is the first token that was not dropped
+func (p *tokenPool) pinned() *pooledToken {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, t := range p.tokens {
+		if !t.dropped {
+			return t
+		}
+	}
+	return nil
+}
+
+// identityRequest tells whether the response depends on who the token belongs to, such as
+// the authenticated user, its private repos or its secret gists
+func identityRequest(req *http.Request) bool {
+	path := strings.TrimPrefix(req.URL.Path, "/api/v3")
+	return path == "/user" || strings.HasPrefix(path, "/user/") || path == "/gists" || strings.HasPrefix(path, "/gists/") ||
+		(strings.HasPrefix(path, "/users/") && strings.HasSuffix(path, "/gists"))
+}
+
+// token is used to clone over HTTPS. Clones don't count against the API quota, and the private
+// repos and secret gists are listed with the pinned token, so they are cloned with it too.
+func (p *tokenPool) token() string {
+	if t := p.pinned(); t != nil {
+		return t.value
+	}
+	return ""
+}
+
+func (p *tokenPool) RoundTrip(req *http.Request) (*http.Response, error) {
+	pin := identityRequest(req)
+	for {
+		t := p.pick()
+		if pin {
+			t = p.pinned()
+		}
+		if t == nil {
+			return nil, errors.New("every token provided was rejected by Github")
+		}
+
+		// a RoundTripper must not modify the request it is given
+		authenticated := *req
+		authenticated.Header = cloneHeader(req.Header)
+		authenticated.Header.Set("Authorization", "token "+t.value)
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			authenticated.Body = body
+		}
+
+		resp, err := p.base.RoundTrip(&authenticated)
+		if err != nil {
+			return nil, err
+		}
+		p.update(t, resp)
+
+		// Another token is used right away when this one has no requests left
+		if !pin && primaryRateLimited(resp) && (req.Body == nil || req.GetBody != nil) {
+			if next := p.pick(); next != nil && next != t && next.quota(time.Now()) > 0 {
+				resp.Body.Close()
+				continue
+			}
+		}
+
+		if resp.StatusCode != http.StatusUnauthorized {
+			return resp, nil
+		}
+		p.drop(t)
+		// The request is sent again with the next token unless its body can't be read twice,
+		// or the next token might belong to another user
+		if pin || (req.Body != nil && req.GetBody == nil) || p.pick() == nil {
+			return resp, nil
+		}
+		resp.Body.Close()
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The calls are spread over the tokens, except the ones whose results depend on the user. Once
+// the pinned token is revoked, its call fails rather than being sent with another user's token,
+// and the next calls are pinned to the next token.
+func TestTokenPoolPinsIdentityRequests(t *testing.T) {
+	remaining := map[string]string{"token first": "10", "token second": "4000", "token third": "3000"}
+	revoked := make(map[string]bool)
+	used := make(map[string][]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("Authorization")
+		used[r.URL.Path] = append(used[r.URL.Path], token)
+		if revoked[token] {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("X-RateLimit-Remaining", remaining[token])
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+	}))
+	defer server.Close()
+
+	pool := newTokenPool("first,second,third")
+	client := &http.Client{Transport: pool}
+	get := func(path string) int {
+		resp, err := client.Get(server.URL + path + "?page=2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	paths := []string{
+		"/orgs/acme/repos", "/orgs/acme/repos", "/orgs/acme/repos", "/orgs/acme/repos",
+		"/api/v3/user/repos", "/user", "/users/jdoe/gists", "/api/v3/users/jdoe/gists", "/users/jdoe/repos",
+	}
+	for _, path := range paths {
+		get(path)
+	}
+
+	if got := strings.Join(used["/orgs/acme/repos"], ","); got != "token first,token second,token third,token second" {
+		t.Errorf("the org repos were listed with %s", got)
+	}
+	for _, path := range []string{"/api/v3/user/repos", "/user", "/users/jdoe/gists", "/api/v3/users/jdoe/gists"} {
+		if got := strings.Join(used[path], ","); got != "token first" {
+			t.Errorf("%s was requested with %s, want the first token", path, got)
+		}
+	}
+	if got := strings.Join(used["/users/jdoe/repos"], ","); got != "token second" {
+		t.Errorf("the user repos were listed with %s", got)
+	}
+
+	revoked["token first"] = true
+	if status := get("/user/repos"); status != http.StatusUnauthorized {
+		t.Errorf("the call with the revoked token got %d, want %d", status, http.StatusUnauthorized)
+	}
+	if status := get("/user/repos"); status != http.StatusOK {
+		t.Errorf("the call after the revoked token got %d, want %d", status, http.StatusOK)
+	}
+	if got := strings.Join(used["/user/repos"], ","); got != "token first,token second" {
+		t.Errorf("the private repos were listed with %s, want the first token then the second one", got)
+	}
+	if get("/orgs/acme/repos"); used["/orgs/acme/repos"][4] == "token first" {
+		t.Error("the revoked token is still used")
+	}
+}
+
+// The repos are cloned with the token that lists the private repos, whatever the API quotas
+func TestTokenPoolCloneToken(t *testing.T) {
+	pool := newTokenPool("first,second")
+	pool.tokens[0].known, pool.tokens[0].remaining, pool.tokens[0].reset = true, 1, time.Now().Add(time.Hour)
+	if token := pool.token(); token != "first" {
+		t.Errorf("cloning with %q, want the first token", token)
+	}
+	pool.drop(pool.tokens[0])
+	if token := pool.token(); token != "second" {
+		t.Errorf("cloning with %q once the first token is dropped, want the second one", token)
+	}
+}